@@ -0,0 +1,188 @@
+package ansihtml
+
+type charset int
+
+const (
+	csASCII charset = iota
+	csDecSpecialGraphics
+	csLatin1Supplement
+	csUK
+	csDutch
+	csFinnish
+	csFrench
+	csFrenchCanadian
+	csGerman
+	csItalian
+	csNorwegianDanish
+	csPortuguese
+	csSpanish
+	csSwedish
+	csSwiss
+)
+
+// 94-character sets, keyed by the designator that follows ESC ( ) * +
+var charsets94 = map[string]charset{
+	"B":  csASCII,
+	"0":  csDecSpecialGraphics,
+	"A":  csUK,
+	"4":  csDutch,
+	"C":  csFinnish,
+	"5":  csFinnish,
+	"R":  csFrench,
+	"f":  csFrench,
+	"Q":  csFrenchCanadian,
+	"9":  csFrenchCanadian,
+	"K":  csGerman,
+	"Y":  csItalian,
+	"E":  csNorwegianDanish,
+	"6":  csNorwegianDanish,
+	"`":  csNorwegianDanish,
+	"%6": csPortuguese,
+	"Z":  csSpanish,
+	"H":  csSwedish,
+	"7":  csSwedish,
+	"=":  csSwiss,
+}
+
+// 96-character sets, keyed by the designator that follows ESC - . /
+var charsets96 = map[string]charset{
+	"A": csLatin1Supplement,
+}
+
+var charsetTables = map[charset]map[rune]rune{
+	csDecSpecialGraphics: {
+		0x5f: ' ',
+		0x60: '◆',
+		0x61: '▒',
+		0x62: '␉',
+		0x63: '␌',
+		0x64: '␍',
+		0x65: '␊',
+		0x66: '°',
+		0x67: '±',
+		0x68: '␤',
+		0x69: '␋',
+		0x6a: '┘',
+		0x6b: '┐',
+		0x6c: '┌',
+		0x6d: '└',
+		0x6e: '┼',
+		0x6f: '⎺',
+		0x70: '⎻',
+		0x71: '─',
+		0x72: '⎼',
+		0x73: '⎽',
+		0x74: '├',
+		0x75: '┤',
+		0x76: '┴',
+		0x77: '┬',
+		0x78: '│',
+		0x79: '≤',
+		0x7a: '≥',
+		0x7b: 'π',
+		0x7c: '≠',
+		0x7d: '£',
+		0x7e: '·',
+	},
+	csUK: {
+		0x23: '£',
+	},
+	csDutch: {
+		0x23: '£', 0x40: '¾', 0x5b: 'ĳ', 0x5c: '½', 0x5d: '|',
+		0x7b: '¨', 0x7c: 'ƒ', 0x7d: '¼', 0x7e: '´',
+	},
+	csFinnish: {
+		0x5b: 'Ä', 0x5c: 'Ö', 0x5d: 'Å', 0x5e: 'Ü', 0x60: 'é',
+		0x7b: 'ä', 0x7c: 'ö', 0x7d: 'å', 0x7e: 'ü',
+	},
+	csFrench: {
+		0x23: '£', 0x40: 'à', 0x5b: '°', 0x5c: 'ç', 0x5d: '§',
+		0x7b: 'é', 0x7c: 'ù', 0x7d: 'è', 0x7e: '¨',
+	},
+	csFrenchCanadian: {
+		0x40: 'à', 0x5b: 'â', 0x5c: 'ç', 0x5d: 'ê', 0x5e: 'î', 0x60: 'ô',
+		0x7b: 'é', 0x7c: 'ù', 0x7d: 'è', 0x7e: 'û',
+	},
+	csGerman: {
+		0x40: '§', 0x5b: 'Ä', 0x5c: 'Ö', 0x5d: 'Ü',
+		0x7b: 'ä', 0x7c: 'ö', 0x7d: 'ü', 0x7e: 'ß',
+	},
+	csItalian: {
+		0x23: '£', 0x40: '§', 0x5b: '°', 0x5c: 'ç', 0x5d: 'é', 0x60: 'ù',
+		0x7b: 'à', 0x7c: 'ò', 0x7d: 'è', 0x7e: 'ì',
+	},
+	csNorwegianDanish: {
+		0x40: 'Ä', 0x5b: 'Æ', 0x5c: 'Ø', 0x5d: 'Å', 0x5e: 'Ü', 0x60: 'ä',
+		0x7b: 'æ', 0x7c: 'ø', 0x7d: 'å', 0x7e: 'ü',
+	},
+	csPortuguese: {
+		0x5b: 'Ã', 0x5c: 'Ç', 0x5d: 'Õ',
+		0x7b: 'ã', 0x7c: 'ç', 0x7d: 'õ',
+	},
+	csSpanish: {
+		0x23: '£', 0x40: '§', 0x5b: '¡', 0x5c: 'Ñ', 0x5d: '¿',
+		0x7b: '°', 0x7c: 'ñ', 0x7d: 'ç',
+	},
+	csSwedish: {
+		0x40: 'É', 0x5b: 'Ä', 0x5c: 'Ö', 0x5d: 'Å', 0x5e: 'Ü', 0x60: 'é',
+		0x7b: 'ä', 0x7c: 'ö', 0x7d: 'å', 0x7e: 'ü',
+	},
+	csSwiss: {
+		0x23: 'ù', 0x40: 'à', 0x5b: 'é', 0x5c: 'ç', 0x5d: 'ê', 0x5e: 'î', 0x5f: 'è', 0x60: 'ô',
+		0x7b: 'ä', 0x7c: 'ö', 0x7d: 'ü', 0x7e: 'û',
+	},
+}
+
+type charsetState struct {
+	g      [4]charset
+	gl     int
+	single int
+}
+
+func (s *charsetState) reset() {
+	*s = charsetState{single: -1}
+}
+
+// designate handles ESC ( ) * + for 94-character sets and ESC - . / for
+// 96-character sets.
+func (s *charsetState) designate(seq *sequence) bool {
+	if len(seq.intermediates) == 0 {
+		return false
+	}
+	key := string(seq.intermediates[1:]) + string(seq.final)
+	switch i := seq.intermediates[0]; i {
+	case xLeftRoundBracket, xRightRoundBracket, xAsterisk, xPlus:
+		if cs, ok := charsets94[key]; ok {
+			s.g[i-xLeftRoundBracket] = cs
+		}
+		return true
+	case xHyphen, xDot, xSlash:
+		if cs, ok := charsets96[key]; ok {
+			s.g[i-xHyphen+1] = cs
+		}
+		return true
+	}
+	return false
+}
+
+func (s *charsetState) translate(char rune) rune {
+	g := s.gl
+	if s.single >= 0 {
+		g = s.single
+		s.single = -1
+	}
+	cs := s.g[g]
+	if char < 0x20 || char > 0x7f {
+		return char
+	}
+	if cs == csLatin1Supplement {
+		return char + 0x80
+	}
+	if char == 0x7f {
+		return char
+	}
+	if r, ok := charsetTables[cs][char]; ok {
+		return r
+	}
+	return char
+}
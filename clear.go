@@ -0,0 +1,115 @@
+package ansihtml
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// screenBuffer keeps the output of the last screens when only the last N
+// are wanted.
+type screenBuffer struct {
+	screens []*bytes.Buffer
+	keep    int
+}
+
+func (b *screenBuffer) Write(p []byte) (int, error) {
+	return b.screens[len(b.screens)-1].Write(p)
+}
+
+func (b *screenBuffer) next() {
+	if len(b.screens) >= b.keep {
+		b.screens = append(b.screens[:0], b.screens[len(b.screens)-b.keep+1:]...)
+	}
+	b.screens = append(b.screens, &bytes.Buffer{})
+}
+
+func (c *Converter) separator() string {
+	return `<hr class="` + c.classPrefix + `screen-separator">`
+}
+
+func (c *Converter) sectionOpen() string {
+	return `<section class="` + c.classPrefix + `screen" data-index="` + strconv.Itoa(c.screenIndex) + `">`
+}
+
+func (b *screenBuffer) writeTo(c *Converter, w io.Writer) error {
+	for i, screen := range b.screens {
+		if i > 0 {
+			if _, err := io.WriteString(w, c.separator()); err != nil {
+				return err
+			}
+		}
+		if _, err := screen.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearScreen marks the end of a screen on ED 2, ED 3 and RIS. Screens
+// without any text are not counted.
+func (c *Converter) clearScreen(w writer) error {
+	if c.clearPolicy == ClearIgnore || !c.screenDirty {
+		return nil
+	}
+	if c.screen != nil {
+		if c.screen.alternate {
+			return nil
+		}
+		if c.keepMainScreen() {
+			if err := c.renderScreen(w, c.screen); err != nil {
+				return err
+			}
+		}
+		c.screen.eraseDisplay(2, cell{})
+	}
+	c.screenDirty = false
+	c.screenIndex++
+	// a command is split in a block on each side of the boundary
+	part := cpNone
+	if c.command != nil && c.command.buf != nil {
+		part = c.commandPart
+		if err := c.endCommand(w, ""); err != nil {
+			return err
+		}
+	}
+	if c.isSpan {
+		if _, err := c.spanClose(w); err != nil {
+			return err
+		}
+		c.isSpan = false
+		c.prevStyle = nil
+		c.styleChanged = true
+	}
+	if c.isAnchor && !c.anchorPending {
+		if _, err := c.anchorClose(w); err != nil {
+			return err
+		}
+	}
+	switch c.clearPolicy {
+	case ClearSeparator:
+		if _, err := w.WriteString(c.separator()); err != nil {
+			return err
+		}
+	case ClearSections:
+		if _, err := w.WriteString("</section>" + c.sectionOpen()); err != nil {
+			return err
+		}
+	case ClearKeepLast:
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		c.screenBuffer.next()
+	}
+	if part != cpNone {
+		if err := c.resumeCommand(w, part); err != nil {
+			return err
+		}
+	}
+	if c.isAnchor && !c.anchorPending {
+		if _, err := c.anchorOpen(w, c.prevAnchor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -164,58 +164,71 @@ const (
 )
 
 const (
-	yReset           = 0
-	yBold            = 1
-	yDim             = 2
-	yItalic          = 3
-	yUnderline       = 4
-	ySlowBlink       = 5
-	yRapidBlink      = 6
-	yInverse         = 7
-	yHidden          = 8
-	yStrike          = 9
-	yNotBold         = 21
-	yNotDim          = 22
-	yNotItalic       = 23
-	yNotUnderline    = 24
-	yNotBlinking     = 25
-	yNotInverse      = 27
-	yNotHidden       = 28
-	yNotStrike       = 29
-	yFgBlack         = 30
-	yFgRed           = 31
-	yFgGreen         = 32
-	yFgYellow        = 33
-	yFgBlue          = 34
-	yFgMagenta       = 35
-	yFgCyan          = 36
-	yFgWhite         = 37
-	yFgExt           = 38
-	yFgReset         = 39
-	yBgBlack         = 40
-	yBgRed           = 41
-	yBgGreen         = 42
-	yBgYellow        = 43
-	yBgBlue          = 44
-	yBgMagenta       = 45
-	yBgCyan          = 46
-	yBgWhite         = 47
-	yBgExt           = 48
-	yBgReset         = 49
-	yBrightFgGray    = 90
-	yBrightFgRed     = 91
-	yBrightFgGreen   = 92
-	yBrightFgYellow  = 93
-	yBrightFgBlue    = 94
-	yBrightFgMagenta = 95
-	yBrightFgCyan    = 96
-	yBrightFgWhite   = 97
-	yBrightBgGray    = 100
-	yBrightBgRed     = 101
-	yBrightBgGreen   = 102
-	yBrightBgYellow  = 103
-	yBrightBgBlue    = 104
-	yBrightBgMagenta = 105
-	yBrightBgCyan    = 106
-	yBrightBgWhite   = 107
+	yReset            = 0
+	yBold             = 1
+	yDim              = 2
+	yItalic           = 3
+	yUnderline        = 4
+	ySlowBlink        = 5
+	yRapidBlink       = 6
+	yInverse          = 7
+	yHidden           = 8
+	yStrike           = 9
+	yPrimaryFont      = 10
+	yAlternativeFont9 = 19
+	yFraktur          = 20
+	yDoubleUnderline  = 21
+	yNormalIntensity  = 22
+	yNotItalic        = 23
+	yNotUnderline     = 24
+	yNotBlinking      = 25
+	yNotInverse       = 27
+	yNotHidden        = 28
+	yNotStrike        = 29
+	yFgBlack          = 30
+	yFgRed            = 31
+	yFgGreen          = 32
+	yFgYellow         = 33
+	yFgBlue           = 34
+	yFgMagenta        = 35
+	yFgCyan           = 36
+	yFgWhite          = 37
+	yFgExt            = 38
+	yFgReset          = 39
+	yBgBlack          = 40
+	yBgRed            = 41
+	yBgGreen          = 42
+	yBgYellow         = 43
+	yBgBlue           = 44
+	yBgMagenta        = 45
+	yBgCyan           = 46
+	yBgWhite          = 47
+	yBgExt            = 48
+	yBgReset          = 49
+	yFramed           = 51
+	yEncircled        = 52
+	yOverline         = 53
+	yNotFramed        = 54
+	yNotOverline      = 55
+	yUlExt            = 58
+	yUlReset          = 59
+	ySuperscript      = 73
+	ySubscript        = 74
+	yNotScript        = 75
+	yBrightFgGray     = 90
+	yBrightFgRed      = 91
+	yBrightFgGreen    = 92
+	yBrightFgYellow   = 93
+	yBrightFgBlue     = 94
+	yBrightFgMagenta  = 95
+	yBrightFgCyan     = 96
+	yBrightFgWhite    = 97
+	yBrightBgGray     = 100
+	yBrightBgRed      = 101
+	yBrightBgGreen    = 102
+	yBrightBgYellow   = 103
+	yBrightBgBlue     = 104
+	yBrightBgMagenta  = 105
+	yBrightBgCyan     = 106
+	yBrightBgWhite    = 107
 )
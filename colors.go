@@ -41,6 +41,91 @@ func toRgb(r rune, g rune, b rune) rune {
 	return (r << 16) | (g << 8) | b
 }
 
+func cmyToRgb(c rune, m rune, y rune) rune {
+	return toRgb(0xff-c, 0xff-m, 0xff-y)
+}
+
+func cmykToRgb(c rune, m rune, y rune, k rune) rune {
+	return toRgb((0xff-c)*(0xff-k)/0xff, (0xff-m)*(0xff-k)/0xff, (0xff-y)*(0xff-k)/0xff)
+}
+
+// extendedColor parses the arguments of SGR 38/48 in either the legacy
+// "38;5;n" form or the ITU T.416 "38:2:cs:r:g:b" form. It returns the number
+// of extra parameters consumed by the legacy form.
+func extendedColor(params [][]rune) (mode colorMode, color rune, n int, ok bool) {
+	args := params[0][1:]
+	colon := len(args) > 0
+	if !colon {
+		args = make([]rune, 0, len(params)-1)
+		for _, p := range params[1:] {
+			args = append(args, p[0])
+		}
+	}
+	if len(args) == 0 {
+		return cmDEFAULT, -1, 0, false
+	}
+
+	var need int
+	switch args[0] {
+	case 1:
+		if colon {
+			return cmDEFAULT, -1, 0, true
+		}
+		return cmDEFAULT, -1, 1, true
+	case 2, 3:
+		need = 3
+	case 4:
+		need = 4
+	case 5:
+		need = 1
+	default:
+		if colon {
+			return cmDEFAULT, -1, 0, false
+		}
+		return cmDEFAULT, -1, 1, false
+	}
+
+	values := args[1:]
+	if colon {
+		if args[0] != 5 && len(values) > need {
+			// skip the colorspace identifier
+			values = values[1:]
+		}
+	} else {
+		if len(values) > need {
+			values = values[:need]
+		}
+		n = 1 + len(values)
+	}
+
+	if args[0] == 5 {
+		if len(values) < need {
+			return cmP256, 0, n, true
+		}
+		return cmP256, values[0], n, true
+	}
+
+	if len(values) < need {
+		return cmRGB, 0, n, true
+	}
+	v := make([]rune, need)
+	for i := range v {
+		v[i] = values[i]
+		if v[i] > 0xff {
+			v[i] = 0xff
+		}
+	}
+	switch args[0] {
+	case 3:
+		color = cmyToRgb(v[0], v[1], v[2])
+	case 4:
+		color = cmykToRgb(v[0], v[1], v[2], v[3])
+	default:
+		color = toRgb(v[0], v[1], v[2])
+	}
+	return cmRGB, color, n, true
+}
+
 func toCSS(rgb int32) string {
 	return fmt.Sprintf("#%06x", rgb)
 }
@@ -0,0 +1,171 @@
+package ansihtml
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// The parts of a command marked by OSC 133 (FinalTerm semantic prompts).
+type commandPart int
+
+const (
+	cpNone commandPart = iota
+	cpPrompt
+	cpInput
+	cpOutput
+)
+
+var commandClasses = map[commandPart]string{
+	cpPrompt: "prompt",
+	cpInput:  "command-input",
+	cpOutput: "command-output",
+}
+
+// commandWriter holds back the markup of a command until its exit code is
+// known, since the block that wraps it is classed by the exit code.
+type commandWriter struct {
+	dst io.Writer
+	buf *bytes.Buffer
+}
+
+func (cw *commandWriter) Write(p []byte) (int, error) {
+	if cw.buf != nil {
+		return cw.buf.Write(p)
+	}
+	return cw.dst.Write(p)
+}
+
+// commandMark handles OSC 133: A starts the prompt, B the command line, C the
+// output and D ends the command with its exit code.
+func (c *Converter) commandMark(w writer, args []string) error {
+	if c.command == nil || len(args) == 0 {
+		return nil
+	}
+	switch args[0] {
+	case "A":
+		if err := c.endCommand(w, ""); err != nil {
+			return err
+		}
+		return c.commandMarkup(w, func() error {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			c.command.buf = &bytes.Buffer{}
+			return c.openCommandPart(w, cpPrompt)
+		})
+	case "B":
+		return c.switchCommandPart(w, cpInput)
+	case "C":
+		return c.switchCommandPart(w, cpOutput)
+	case "D":
+		var exit string
+		if len(args) > 1 {
+			if _, err := strconv.Atoi(args[1]); err == nil {
+				exit = args[1]
+			}
+		}
+		return c.endCommand(w, exit)
+	}
+	return nil
+}
+
+// commandMarkup closes the span and the anchor around the markup written by
+// cb, they are opened again by the next character. The line buffered so far
+// goes first.
+func (c *Converter) commandMarkup(w writer, cb func() error) error {
+	if c.screen != nil {
+		if err := c.flushLine(w); err != nil {
+			return err
+		}
+	}
+	if c.isSpan {
+		if _, err := c.spanClose(w); err != nil {
+			return err
+		}
+		c.isSpan = false
+		c.prevStyle = nil
+		c.styleChanged = true
+	}
+	if c.isAnchor && !c.anchorPending {
+		if _, err := c.anchorClose(w); err != nil {
+			return err
+		}
+		c.anchorPending = true
+	}
+	return cb()
+}
+
+// resumeCommand opens the block of a command again in the part it was in.
+func (c *Converter) resumeCommand(w writer, part commandPart) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	c.command.buf = &bytes.Buffer{}
+	return c.openCommandPart(w, part)
+}
+
+func (c *Converter) openCommandPart(w writer, part commandPart) error {
+	c.commandPart = part
+	_, err := w.WriteString(`<span class="` + c.classPrefix + commandClasses[part] + `">`)
+	return err
+}
+
+func (c *Converter) closeCommandPart(w writer) error {
+	if c.commandPart == cpNone {
+		return nil
+	}
+	c.commandPart = cpNone
+	_, err := w.WriteString("</span>")
+	return err
+}
+
+func (c *Converter) switchCommandPart(w writer, part commandPart) error {
+	if c.command.buf == nil || c.commandPart >= part {
+		return nil
+	}
+	return c.commandMarkup(w, func() error {
+		if err := c.closeCommandPart(w); err != nil {
+			return err
+		}
+		return c.openCommandPart(w, part)
+	})
+}
+
+// endCommand writes the block of the current command. A command without exit
+// code, ended by the next prompt or the end of the input, is not classed by
+// its result.
+func (c *Converter) endCommand(w writer, exit string) error {
+	if c.command == nil || c.command.buf == nil {
+		return nil
+	}
+	return c.commandMarkup(w, func() error {
+		if err := c.closeCommandPart(w); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		buf := c.command.buf
+		c.command.buf = nil
+		class := c.classPrefix + "command"
+		if exit != "" && exit != "0" {
+			class += " " + c.classPrefix + "command-failed"
+		}
+		open := `<div class="` + class + `"`
+		if exit != "" {
+			open += ` data-exit="` + exit + `"`
+		}
+		if _, err := w.WriteString(open + ">"); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if _, err := buf.WriteTo(c.command.dst); err != nil {
+			return err
+		}
+		_, err := w.WriteString("</div>")
+		return err
+	})
+}
@@ -0,0 +1,92 @@
+package ansihtml
+
+import (
+	"bufio"
+	"fmt"
+	"unicode/utf8"
+)
+
+// cp437 maps the bytes 0x80-0xff of code page 437.
+var cp437 = []rune("ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒáíóúñÑªº¿⌐¬½¼¡«»" +
+	"░▒▓│┤╡╢╖╕╣║╗╝╜╛┐└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀" +
+	"αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■ ")
+
+func decodeByte(cs InputCharset, b byte) rune {
+	if cs == CP437 && b >= 0x80 {
+		return cp437[b-0x80]
+	}
+	return rune(b)
+}
+
+func (c *Converter) readRune(r *bufio.Reader) (rune, error) {
+	for {
+		char, err := c.decodeRune(r)
+		if err != nil {
+			return 0, err
+		}
+		if char < 0x80 || char >= 0xa0 {
+			return char, nil
+		}
+		// C17Bit has turned them into text already, except where the policy
+		// reads a byte as Latin-1
+		if c.c1Mode == C1Ignored || c.c1Mode == C17Bit {
+			continue
+		}
+		return char, nil
+	}
+}
+
+func (c *Converter) decodeRune(r *bufio.Reader) (rune, error) {
+	if len(c.decoded) > 0 {
+		char := c.decoded[0]
+		c.decoded = c.decoded[1:]
+		return char, nil
+	}
+	if c.inputCharset != UTF8 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b >= 0x80 && b < 0xa0 {
+			switch c.c1Mode {
+			case C1Raw:
+				return rune(b), nil
+			case C17Bit:
+				if c.inputCharset == Latin1 {
+					return c.invalidByte(r, b)
+				}
+			}
+		}
+		return decodeByte(c.inputCharset, b), nil
+	}
+	char, size, err := r.ReadRune()
+	if c.c1Mode == C17Bit && char >= 0x80 && char < 0xa0 {
+		// a code point, there is no byte to show
+		return utf8.RuneError, err
+	}
+	if err != nil || char != utf8.RuneError || size != 1 {
+		return char, err
+	}
+	_ = r.UnreadRune()
+	b, _ := r.ReadByte()
+	// never a lead byte in UTF-8, so not to be mistaken for text
+	if c.c1Mode == C1Raw && b >= 0x80 && b < 0xa0 {
+		return rune(b), nil
+	}
+	return c.invalidByte(r, b)
+}
+
+// invalidByte decodes a byte that is not text, as told by the
+// InvalidUTF8Policy.
+func (c *Converter) invalidByte(r *bufio.Reader, b byte) (rune, error) {
+	switch c.invalidUTF8 {
+	case InvalidEscape:
+		c.decoded = []rune(fmt.Sprintf(`\x%02X`, b))
+		return c.decodeRune(r)
+	case InvalidLatin1:
+		return decodeByte(Latin1, b), nil
+	case InvalidCP437:
+		return decodeByte(CP437, b), nil
+	}
+	return utf8.RuneError, nil
+}
@@ -22,7 +22,9 @@ var files embed.FS
 
 func ToDemo(ansiText string, options ...Option) (string, error) {
 	type demo struct {
+		Title      string
 		Class      template.CSS
+		Stylesheet template.CSS
 		Foreground template.CSS
 		Background template.CSS
 		FontFamily template.CSS
@@ -134,8 +136,10 @@ func ToDemo(ansiText string, options ...Option) (string, error) {
 	}
 	output := &strings.Builder{}
 	payload := demo{
+		Title:      converter.Metadata().Title(),
 		FontSize:   "",
 		Class:      "",
+		Stylesheet: template.CSS(converter.Stylesheet()),
 		Foreground: template.CSS(fg),
 		Background: template.CSS(bg),
 		Content:    template.HTML(content.String()),
@@ -180,8 +184,37 @@ func ToDemo(ansiText string, options ...Option) (string, error) {
 	.ansi-underline { text-decoration: underline }
 	.ansi-strike { text-decoration: line-through }
 	.ansi-underline.ansi-strike { text-decoration: underline line-through }
+	.ansi-overline { text-decoration: overline }
+	.ansi-underline.ansi-overline { text-decoration: underline overline }
+	.ansi-overline.ansi-strike { text-decoration: overline line-through }
+	.ansi-underline.ansi-overline.ansi-strike { text-decoration: underline overline line-through }
+	.ansi-underline-double { text-decoration-style: double }
+	.ansi-underline-curly { text-decoration-style: wavy }
+	.ansi-underline-dotted { text-decoration-style: dotted }
+	.ansi-underline-dashed { text-decoration-style: dashed }
+	.ansi-ul-0 { text-decoration-color: #3f4451 }
+	.ansi-ul-1 { text-decoration-color: #e05561 }
+	.ansi-ul-2 { text-decoration-color: #8cc265 }
+	.ansi-ul-3 { text-decoration-color: #d18f52 }
+	.ansi-ul-4 { text-decoration-color: #4aa5f0 }
+	.ansi-ul-5 { text-decoration-color: #c162de }
+	.ansi-ul-6 { text-decoration-color: #42b3c2 }
+	.ansi-ul-7 { text-decoration-color: #e6e6e6 }
+	.ansi-ul-8 { text-decoration-color: #4f5666 }
+	.ansi-ul-9 { text-decoration-color: #ff616e }
+	.ansi-ul-10 { text-decoration-color: #a5e075 }
+	.ansi-ul-11 { text-decoration-color: #f0a45d }
+	.ansi-ul-12 { text-decoration-color: #4dc4ff }
+	.ansi-ul-13 { text-decoration-color: #de73ff }
+	.ansi-ul-14 { text-decoration-color: #4cd1e0 }
+	.ansi-ul-15 { text-decoration-color: #d7dae0 }
 	.ansi-italic { font-style:italic }
 	.ansi-hidden { opacity: 0 }
+	.ansi-fraktur { font-family: UnifrakturMaguntia, UnifrakturCook, fantasy }
+	.ansi-framed { outline: 1px solid }
+	.ansi-encircled { outline: 1px solid; border-radius: 1em }
+	.ansi-superscript { vertical-align: super; font-size: smaller }
+	.ansi-subscript { vertical-align: sub; font-size: smaller }
 	.ansi-link { color: %s; text-decoration: none }
 	.ansi-link:hover { text-decoration: underline }`, bg, fg, fg))
 	}
@@ -0,0 +1,111 @@
+package ansihtml
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Output is what a Handler writes to. Text is escaped and styled like
+// printed characters, HTML is written as is.
+type Output interface {
+	WriteText(s string) error
+	WriteHTML(s string) error
+	SetAttributes(params ...int) error
+}
+
+// Handler handles a sequence in place of the converter. It can return
+// ErrNotSupported to leave the sequence to the converter.
+type Handler func(out Output, seq *Sequence) error
+
+type handlerKey struct {
+	kind SequenceKind
+	id   int
+}
+
+// Handle registers h for the sequences of the kind, identified by their final
+// byte for ESC, CSI and DCS, by their number for OSC, and by 0 for SOS, PM
+// and APC. A nil h removes the handler.
+func (c *Converter) Handle(kind SequenceKind, id int, h Handler) {
+	key := handlerKey{kind, id}
+	if h == nil {
+		delete(c.handlers, key)
+		return
+	}
+	if c.handlers == nil {
+		c.handlers = map[handlerKey]Handler{}
+	}
+	c.handlers[key] = h
+}
+
+func SetHandler(kind SequenceKind, id int, h Handler) Option {
+	return func(c *Converter) {
+		c.Handle(kind, id, h)
+	}
+}
+
+type handlerOutput struct {
+	c *Converter
+	w writer
+}
+
+func (o *handlerOutput) WriteText(s string) error {
+	for _, char := range s {
+		if err := o.c.printChar(o.w, char); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *handlerOutput) WriteHTML(s string) error {
+	if o.c.screen != nil {
+		o.c.screen.markup(s)
+		return nil
+	}
+	_, err := o.w.WriteString(s)
+	return err
+}
+
+func (o *handlerOutput) SetAttributes(params ...int) error {
+	sgr := make([][]rune, len(params))
+	for i, v := range params {
+		sgr[i] = []rune{rune(v)}
+	}
+	if len(sgr) == 0 {
+		sgr = [][]rune{{0}}
+	}
+	o.c.setAttributes(sgr)
+	o.c.styleChanged = true
+	return nil
+}
+
+// hook runs the handler registered for the sequence. It reports false when
+// there is none or the handler leaves the sequence to the converter.
+func (c *Converter) hook(w writer, id int, seq *Sequence) (bool, error) {
+	h, ok := c.handlers[handlerKey{seq.Kind, id}]
+	if !ok {
+		return false, nil
+	}
+	err := h(&handlerOutput{c, w}, seq)
+	if errors.Is(err, ErrNotSupported) {
+		return false, nil
+	}
+	return true, err
+}
+
+func (c *Converter) hookOSC(w writer, data string) (bool, error) {
+	if len(c.handlers) == 0 {
+		return false, nil
+	}
+	args := strings.SplitN(data, ";", 2)
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return false, nil
+	}
+	seq := &Sequence{Kind: OSC, Params: [][]int{{id}}}
+	if len(args) > 1 {
+		seq.Data = args[1]
+	}
+	return c.hook(w, id, seq)
+}
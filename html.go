@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -24,6 +25,72 @@ type render interface {
 	anchorClose(w writer) (size int, err error)
 }
 
+const blinkHighlight = "0 0 0.25em currentColor"
+
+// Stylesheet returns the rules that inline styles cannot express, such as the
+// blink keyframes and the reveal behaviour of concealed text.
+func (c *Converter) Stylesheet() string {
+	return c.blinkCSS() + c.concealCSS() + c.fillCSS()
+}
+
+// A fill takes no room in the line and extends past its end, so it should
+// be clipped by the container.
+func (c *Converter) fillCSS() string {
+	return "." + c.classPrefix + "fill { display: inline-block; width: 100vw; margin-right: -100vw }\n"
+}
+
+// Animations are turned off for users who prefer reduced motion.
+func (c *Converter) blinkCSS() string {
+	p := c.classPrefix
+	if c.blinkMode == BlinkStatic {
+		return "." + p + "blink, ." + p + "rapid-blink { text-shadow: " + blinkHighlight + " }\n"
+	}
+	return "@keyframes " + p + "blink { 50% { opacity: 0 } }\n" +
+		"." + p + "blink { animation: " + p + "blink 1s step-end infinite }\n" +
+		"." + p + "rapid-blink { animation: " + p + "blink 0.4s step-end infinite }\n" +
+		"@media (prefers-reduced-motion: reduce) {\n" +
+		"\t." + p + "blink, ." + p + "rapid-blink, [style*=\"" + p + "blink \"] { animation: none !important }\n" +
+		"}\n"
+}
+
+func (c *Converter) concealCSS() string {
+	p := c.classPrefix
+	switch c.concealMode {
+	case ConcealReveal:
+		return "." + p + "concealed:not(:hover) { color: transparent !important }\n" +
+			"." + p + "concealed::selection { color: HighlightText; background-color: Highlight }\n"
+	case ConcealRedact:
+		return "." + p + "redacted { user-select: none }\n"
+	}
+	return ""
+}
+
+func defaultFonts() [11]string {
+	return [11]string{10: "UnifrakturMaguntia, UnifrakturCook, fantasy"}
+}
+
+var concealClasses = map[ConcealMode]string{
+	ConcealInvisible: "hidden",
+	ConcealReveal:    "concealed",
+	ConcealRedact:    "redacted",
+}
+
+var underlineStyles = map[underlineStyle]string{
+	ulSingle: "solid",
+	ulDouble: "double",
+	ulCurly:  "wavy",
+	ulDotted: "dotted",
+	ulDashed: "dashed",
+}
+
+var underlineClasses = map[underlineStyle]string{
+	ulSingle: "single",
+	ulDouble: "double",
+	ulCurly:  "curly",
+	ulDotted: "dotted",
+	ulDashed: "dashed",
+}
+
 func (c *Converter) spanOpen(w writer, s *spanStyle) (size int64, err error) {
 	buf := &bytes.Buffer{}
 	var classes []string
@@ -48,8 +115,21 @@ func (c *Converter) spanOpen(w writer, s *spanStyle) (size int64, err error) {
 		if s.bold {
 			classes = append(classes, c.classPrefix+"bold")
 		}
-		if s.underline {
+		if s.underline != ulNone {
 			classes = append(classes, c.classPrefix+"underline")
+			if s.underline != ulSingle {
+				classes = append(classes, c.classPrefix+"underline-"+underlineClasses[s.underline])
+			}
+			if s.underlineColor != "" {
+				if s.ulMode != cmRGB {
+					classes = append(classes, c.classPrefix+"ul-"+s.underlineColor)
+				} else {
+					props["text-decoration-color"] = s.underlineColor
+				}
+			}
+		}
+		if s.overline {
+			classes = append(classes, c.classPrefix+"overline")
 		}
 		if s.strike {
 			classes = append(classes, c.classPrefix+"strike")
@@ -60,11 +140,31 @@ func (c *Converter) spanOpen(w writer, s *spanStyle) (size int64, err error) {
 		if s.dim {
 			classes = append(classes, c.classPrefix+"dim")
 		}
-		if s.blink {
+		switch s.blink {
+		case blinkSlow:
 			classes = append(classes, c.classPrefix+"blink")
+		case blinkRapid:
+			classes = append(classes, c.classPrefix+"rapid-blink")
 		}
 		if s.hidden {
-			classes = append(classes, c.classPrefix+"hidden")
+			classes = append(classes, c.classPrefix+concealClasses[c.concealMode])
+		}
+		if s.framed {
+			classes = append(classes, c.classPrefix+"framed")
+		}
+		if s.encircled {
+			classes = append(classes, c.classPrefix+"encircled")
+		}
+		if s.font == 10 {
+			classes = append(classes, c.classPrefix+"fraktur")
+		} else if s.font != 0 {
+			classes = append(classes, c.classPrefix+"font-"+strconv.Itoa(s.font))
+		}
+		switch s.script {
+		case spSuperscript:
+			classes = append(classes, c.classPrefix+"superscript")
+		case spSubscript:
+			classes = append(classes, c.classPrefix+"subscript")
 		}
 	} else {
 		if s.foreground != "" {
@@ -76,20 +176,58 @@ func (c *Converter) spanOpen(w writer, s *spanStyle) (size int64, err error) {
 		if s.bold {
 			props["font-weight"] = "bold"
 		}
-		if s.underline || s.strike {
+		if s.underline != ulNone || s.overline || s.strike {
 			var values []string
-			if s.underline {
+			if s.underline != ulNone {
 				values = append(values, "underline")
+				if s.underline != ulSingle {
+					props["text-decoration-style"] = underlineStyles[s.underline]
+				}
+				if s.underlineColor != "" {
+					props["text-decoration-color"] = s.underlineColor
+				}
+			}
+			if s.overline {
+				values = append(values, "overline")
 			}
 			if s.strike {
 				values = append(values, "line-through")
 			}
 			props["text-decoration"] = strings.Join(values, " ")
 		}
+		if s.framed || s.encircled {
+			props["outline"] = "1px solid"
+			if s.encircled {
+				props["border-radius"] = "1em"
+			}
+		}
+		switch s.script {
+		case spSuperscript:
+			props["vertical-align"] = "super"
+			props["font-size"] = "smaller"
+		case spSubscript:
+			props["vertical-align"] = "sub"
+			props["font-size"] = "smaller"
+		}
 		if s.italic {
 			props["font-style"] = "italic"
 		}
-		if s.hidden {
+		if s.font != 0 && c.fonts[s.font] != "" {
+			props["font-family"] = c.fonts[s.font]
+		}
+		if s.blink != blinkNone {
+			if c.blinkMode == BlinkStatic {
+				props["text-shadow"] = blinkHighlight
+			} else if s.blink == blinkRapid {
+				props["animation"] = c.classPrefix + "blink 0.4s step-end infinite"
+			} else {
+				props["animation"] = c.classPrefix + "blink 1s step-end infinite"
+			}
+		}
+		if s.hidden && c.concealMode != ConcealInvisible {
+			classes = append(classes, c.classPrefix+concealClasses[c.concealMode])
+		}
+		if s.hidden && c.concealMode == ConcealInvisible {
 			props["opacity"] = "0"
 		} else if s.dim {
 			if s.background == "" {
@@ -140,6 +278,17 @@ func (c *Converter) spanOpen(w writer, s *spanStyle) (size int64, err error) {
 	return io.Copy(w, buf)
 }
 
+// fill paints the background of the rest of the line.
+func (c *Converter) fill(w writer, s *spanStyle) (size int, err error) {
+	if c.isClass && s.bgMode != cmRGB {
+		return w.WriteString(`<span class="` + c.classPrefix + "fill " + c.classPrefix + "bg-" + s.background + `"> </span>`)
+	}
+	if c.isClass {
+		return w.WriteString(`<span class="` + c.classPrefix + `fill" style="background-color:` + s.background + `"> </span>`)
+	}
+	return w.WriteString(`<span style="background-color:` + s.background + `;display:inline-block;margin-right:-100vw;width:100vw"> </span>`)
+}
+
 func (c *Converter) spanClose(w writer) (size int, err error) {
 	return w.WriteString("</span>")
 }
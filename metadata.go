@@ -0,0 +1,48 @@
+package ansihtml
+
+import "net/url"
+
+// Metadata is what the output told the terminal about itself: the window
+// titles (OSC 0 and 2) and icon names (OSC 0 and 1) in the order they were
+// set, and the working directory reported by OSC 7.
+type Metadata struct {
+	Titles    []string
+	IconNames []string
+	Host      string
+	Cwd       string
+}
+
+// Title returns the last window title.
+func (m Metadata) Title() string {
+	if len(m.Titles) == 0 {
+		return ""
+	}
+	return m.Titles[len(m.Titles)-1]
+}
+
+// Metadata returns what has been collected since the last Reset.
+func (c *Converter) Metadata() Metadata {
+	m := c.metadata
+	m.Titles = append([]string(nil), m.Titles...)
+	m.IconNames = append([]string(nil), m.IconNames...)
+	return m
+}
+
+func (c *Converter) setTitle(mode int, title string) {
+	if mode == 0 || mode == 2 {
+		c.metadata.Titles = append(c.metadata.Titles, title)
+	}
+	if mode == 0 || mode == 1 {
+		c.metadata.IconNames = append(c.metadata.IconNames, title)
+	}
+}
+
+// setCwd takes a file URL, such as file://host/home/user.
+func (c *Converter) setCwd(s string) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "file" {
+		return
+	}
+	c.metadata.Host = u.Host
+	c.metadata.Cwd = u.Path
+}
@@ -4,7 +4,8 @@ type Option func(*Converter)
 
 func SetTheme(theme Theme) Option {
 	return func(c *Converter) {
-		c.palette = buildPalette(theme)
+		c.theme = buildPalette(theme)
+		c.palette = c.theme.clone()
 	}
 }
 
@@ -32,12 +33,138 @@ func SetEscapeHTML(b bool) Option {
 	}
 }
 
+// SetFont maps the alternative font n (1-9, selected by SGR 11-19) or
+// Fraktur (10, SGR 20) to a CSS font-family value.
+func SetFont(n int, family string) Option {
+	return func(c *Converter) {
+		if n > 0 && n < len(c.fonts) {
+			c.fonts[n] = family
+		}
+	}
+}
+
+func SetBlinkMode(mode BlinkMode) Option {
+	return func(c *Converter) {
+		c.blinkMode = mode
+	}
+}
+
+func SetConcealMode(mode ConcealMode) Option {
+	return func(c *Converter) {
+		c.concealMode = mode
+	}
+}
+
+func SetRedactionMarker(marker string) Option {
+	return func(c *Converter) {
+		c.redactionMarker = marker
+	}
+}
+
+func SetOverstrike(b bool) Option {
+	return func(c *Converter) {
+		c.overstrikeMode = b
+	}
+}
+
+// SetEmulation selects how much of the terminal is emulated. LineBuffer
+// keeps the current line until a line feed, so carriage returns and erase in
+// line overwrite text instead of repeating it. Screen keeps a grid of cells
+// with cursor addressing, see SetScreenSize.
+func SetEmulation(e Emulation) Option {
+	return func(c *Converter) {
+		c.emulation = e
+	}
+}
+
+// SetScreenSize sets the number of columns and rows of the Screen emulation.
+// The default is 80x24.
+func SetScreenSize(cols int, rows int) Option {
+	return func(c *Converter) {
+		if cols > 0 && rows > 0 {
+			c.columns = cols
+			c.rows = rows
+		}
+	}
+}
+
+// SetColumns sets the terminal width. Lines longer than n columns wrap as
+// with DECAWM, counting East Asian wide characters as two columns. A Stream
+// converter with columns set buffers lines like LineBuffer.
+func SetColumns(n int) Option {
+	return func(c *Converter) {
+		if n >= 0 {
+			c.columns = n
+		}
+	}
+}
+
+// SetAltScreenPolicy chooses what the Screen emulation keeps of the
+// alternate screen: nothing, only the alternate screen sessions, or the main
+// screen followed by every session as a separate block.
+func SetAltScreenPolicy(policy AltScreenPolicy) Option {
+	return func(c *Converter) {
+		c.altScreenPolicy = policy
+	}
+}
+
+// SetClearPolicy chooses what happens when the screen is cleared by ED 2,
+// ED 3 or RIS: nothing, a separator, a section for each screen, or keeping
+// only the last screens, see SetKeepScreens.
+func SetClearPolicy(policy ClearPolicy) Option {
+	return func(c *Converter) {
+		c.clearPolicy = policy
+	}
+}
+
+func SetKeepScreens(n int) Option {
+	return func(c *Converter) {
+		if n > 0 {
+			c.keepScreens = n
+		}
+	}
+}
+
+// SetCommandBlocks wraps each command marked by OSC 133 in a block, with its
+// prompt, command line and output marked up. The Screen emulation, which has
+// no order of lines to put them in, fails with ErrNotSupported.
+func SetCommandBlocks(enable bool) Option {
+	return func(c *Converter) {
+		c.commandBlocks = enable
+	}
+}
+
+func SetStringHandler(h StringHandler) Option {
+	return func(c *Converter) {
+		c.stringHandler = h
+	}
+}
+
+func SetC1Mode(mode C1Mode) Option {
+	return func(c *Converter) {
+		c.c1Mode = mode
+	}
+}
+
+func SetInputCharset(cs InputCharset) Option {
+	return func(c *Converter) {
+		c.inputCharset = cs
+	}
+}
+
+func SetInvalidUTF8Policy(policy InvalidUTF8Policy) Option {
+	return func(c *Converter) {
+		c.invalidUTF8 = policy
+	}
+}
+
 type Options struct {
 	Mode                 Mode
 	ClassPrefix          string
 	MinimumContrastRatio float64
 	Theme                Theme
 	EscapeHTML           bool
+	Fonts                map[int]string
 }
 
 func SetOptions(opts Options) Option {
@@ -48,7 +175,14 @@ func SetOptions(opts Options) Option {
 			c.minimumContrastRatio = 3
 		}
 		c.classPrefix = opts.ClassPrefix
-		c.palette = buildPalette(opts.Theme)
+		c.theme = buildPalette(opts.Theme)
+		c.palette = c.theme.clone()
 		c.escapeHTML = opts.EscapeHTML
+		c.fonts = defaultFonts()
+		for n, family := range opts.Fonts {
+			if n > 0 && n < len(c.fonts) {
+				c.fonts[n] = family
+			}
+		}
 	}
 }
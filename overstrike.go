@@ -0,0 +1,64 @@
+package ansihtml
+
+// Overstrike follows the nroff conventions understood by less(1):
+// "c BS c" is bold and "_ BS c" is underlined.
+type overstrike struct {
+	char       rune
+	active     bool
+	backspaced bool
+	bold       bool
+	underline  bool
+}
+
+func (c *Converter) overstrikePrint(w writer, char rune) error {
+	o := &c.overstrike
+	if o.active && o.backspaced {
+		o.backspaced = false
+		switch {
+		case char == o.char:
+			o.bold = true
+		case o.char == '_':
+			o.char = char
+			o.underline = true
+		case char == '_':
+			o.underline = true
+		default:
+			o.char = char
+		}
+		return nil
+	}
+	if err := c.flushOverstrike(w); err != nil {
+		return err
+	}
+	*o = overstrike{char: char, active: true}
+	return nil
+}
+
+func (c *Converter) overstrikeBackspace() bool {
+	if !c.overstrike.active || c.overstrike.backspaced {
+		return false
+	}
+	c.overstrike.backspaced = true
+	return true
+}
+
+func (c *Converter) flushOverstrike(w writer) error {
+	o := c.overstrike
+	if !o.active {
+		return nil
+	}
+	c.overstrike = overstrike{}
+	if !o.bold && !o.underline {
+		return c.printChar(w, o.char)
+	}
+	bold, underline := c.bold, c.underline
+	c.bold = c.bold || o.bold
+	if o.underline && c.underline == ulNone {
+		c.underline = ulSingle
+	}
+	c.styleChanged = true
+	err := c.printChar(w, o.char)
+	c.bold, c.underline = bold, underline
+	c.styleChanged = true
+	return err
+}
@@ -0,0 +1,140 @@
+package ansihtml
+
+import (
+	"strconv"
+	"strings"
+)
+
+func (p palette) clone() palette {
+	p.colors = append([]*colorObject(nil), p.colors...)
+	return p
+}
+
+// color returns the entry a span color refers to, the default foreground or
+// background when it has no index.
+func (p palette) color(mode colorMode, index rune, foreground bool) *colorObject {
+	switch mode {
+	case cmP16, cmP256:
+		if index >= 0 && int(index) < len(p.colors) {
+			return p.colors[index]
+		}
+	case cmDEFAULT:
+		if foreground {
+			return p.foreground
+		}
+		return p.background
+	}
+	return nil
+}
+
+// overridden reports whether an OSC sequence has changed the color from the
+// theme. Class mode writes such colors inline, since the classes still name
+// the theme colors.
+func (c *Converter) overridden(mode colorMode, index rune, foreground bool) bool {
+	a, b := c.palette.color(mode, index, foreground), c.theme.color(mode, index, foreground)
+	if a == nil || b == nil {
+		return a != b
+	}
+	return a.rgb != b.rgb
+}
+
+func (c *Converter) paletteChanged() {
+	c.contrastCache.Clear()
+	c.styleChanged = true
+	c.cellStyle = nil
+}
+
+func (c *Converter) resetPalette() {
+	c.palette = c.theme.clone()
+	c.paletteChanged()
+}
+
+// setPalette handles OSC 4 and OSC 104, whose arguments are index and color
+// pairs, and indexes to reset. OSC 104 without arguments resets them all.
+func (c *Converter) setPalette(mode int, args []string) {
+	if mode == 104 && len(args) == 0 {
+		c.palette.colors = c.theme.clone().colors
+		c.paletteChanged()
+		return
+	}
+	for i := 0; i < len(args); i++ {
+		index, err := strconv.Atoi(args[i])
+		if err != nil || index < 0 || index >= len(c.palette.colors) {
+			if mode == 4 {
+				i++
+			}
+			continue
+		}
+		if mode == 104 {
+			c.palette.colors[index] = c.theme.colors[index]
+		} else if i+1 < len(args) {
+			i++
+			if color := parseColorSpec(args[i]); color != nil {
+				c.palette.colors[index] = color
+			}
+		}
+	}
+	c.paletteChanged()
+}
+
+// setDynamicColor handles OSC 10, 11 and 12, where each further argument sets
+// the next of the foreground, background and cursor colors. The cursor is not
+// rendered, so its color is ignored.
+func (c *Converter) setDynamicColor(mode int, args []string) {
+	for i, spec := range args {
+		color := parseColorSpec(spec)
+		if color == nil {
+			continue
+		}
+		switch mode + i {
+		case 10:
+			c.palette.foreground = color
+		case 11:
+			c.palette.background = color
+		}
+	}
+	c.paletteChanged()
+}
+
+func (c *Converter) resetDynamicColor(mode int) {
+	switch mode {
+	case 110:
+		c.palette.foreground = c.theme.foreground
+	case 111:
+		c.palette.background = c.theme.background
+	}
+	c.paletteChanged()
+}
+
+// parseColorSpec parses the X11 color specifications used by xterm, such as
+// rgb:ff/80/00 and #ff8000, besides the CSS colors of a Theme. A "?" queries
+// the color and gives nil.
+func parseColorSpec(spec string) *colorObject {
+	var parts []string
+	switch {
+	case strings.HasPrefix(spec, "rgb:"):
+		parts = strings.Split(spec[4:], "/")
+		if len(parts) != 3 {
+			return nil
+		}
+	case strings.HasPrefix(spec, "#") && len(spec) > 7 && (len(spec)-1)%3 == 0:
+		n := (len(spec) - 1) / 3
+		parts = []string{spec[1 : 1+n], spec[1+n : 1+2*n], spec[1+2*n:]}
+	default:
+		return toColorObject(strings.ToLower(spec))
+	}
+	var rgb rune
+	for _, part := range parts {
+		if len(part) == 0 || len(part) > 4 {
+			return nil
+		}
+		v, err := strconv.ParseUint(part, 16, 16)
+		if err != nil {
+			return nil
+		}
+		// scale 1 to 4 hex digits to 8 bits
+		max := uint64(1)<<(4*len(part)) - 1
+		rgb = rgb<<8 | rune((v*255+max/2)/max)
+	}
+	return &colorObject{rgb: rgb, css: toCSS(rgb)}
+}
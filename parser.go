@@ -2,6 +2,7 @@ package ansihtml
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -16,33 +17,156 @@ const (
 	Class
 )
 
+type ConcealMode int
+
+const (
+	ConcealInvisible ConcealMode = iota
+	ConcealReveal
+	ConcealRedact
+)
+
+type BlinkMode int
+
+const (
+	BlinkAnimated BlinkMode = iota
+	BlinkStatic
+)
+
+type Emulation int
+
+const (
+	Stream Emulation = iota
+	LineBuffer
+	Screen
+)
+
+type AltScreenPolicy int
+
+const (
+	AltScreenMainOnly AltScreenPolicy = iota
+	AltScreenOnly
+	AltScreenBoth
+)
+
+type ClearPolicy int
+
+const (
+	ClearIgnore ClearPolicy = iota
+	ClearSeparator
+	ClearSections
+	ClearKeepLast
+)
+
+// C1Mode tells how the C1 controls (0x80-0x9f) are recognized. C1Decoded
+// takes them from the decoded input, as code points U+0080-U+009F in UTF-8
+// and as bytes in Latin-1, and C1Ignored drops them there. C1Raw also takes
+// the bytes 0x80-0x9f, which are invalid on their own in UTF-8 and glyphs in
+// CP437, as C1 controls. C17Bit decodes the input like C1Decoded but
+// leaves only the 7-bit ESC forms: C1 bytes are printed as invalid input
+// following the InvalidUTF8Policy, and C1 code points as U+FFFD.
+type C1Mode int
+
+const (
+	C1Decoded C1Mode = iota
+	C1Ignored
+	C1Raw
+	C17Bit
+)
+
+type InputCharset int
+
+const (
+	UTF8 InputCharset = iota
+	Latin1
+	CP437
+)
+
+// InvalidUTF8Policy tells what becomes of the bytes that are not valid UTF-8:
+// U+FFFD, a visible \xNN escape, or the character of the byte in Latin-1 or
+// CP437.
+type InvalidUTF8Policy int
+
+const (
+	InvalidReplace InvalidUTF8Policy = iota
+	InvalidEscape
+	InvalidLatin1
+	InvalidCP437
+)
+
+type underlineStyle int
+
+const (
+	ulNone underlineStyle = iota
+	ulSingle
+	ulDouble
+	ulCurly
+	ulDotted
+	ulDashed
+)
+
+type blinkSpeed int
+
+const (
+	blinkNone blinkSpeed = iota
+	blinkSlow
+	blinkRapid
+)
+
+type scriptPosition int
+
+const (
+	spBaseline scriptPosition = iota
+	spSuperscript
+	spSubscript
+)
+
 type attributes struct {
 	fgIndexOrRgb rune
 	bgIndexOrRgb rune
+	ulIndexOrRgb rune
 	fgMode       colorMode
 	bgMode       colorMode
+	ulMode       colorMode
 	bold         bool
 	dim          bool
-	underline    bool
-	blink        bool
+	underline    underlineStyle
+	blink        blinkSpeed
 	inverse      bool
 	italic       bool
 	strike       bool
 	hidden       bool
+	overline     bool
+	framed       bool
+	encircled    bool
+	script       scriptPosition
+	font         int
 }
 
 type spanStyle struct {
-	fgMode     colorMode
-	foreground string
-	bgMode     colorMode
-	background string
-	bold       bool
-	dim        bool
-	underline  bool
-	blink      bool
-	italic     bool
-	strike     bool
-	hidden     bool
+	fgMode         colorMode
+	foreground     string
+	bgMode         colorMode
+	background     string
+	ulMode         colorMode
+	underlineColor string
+	bold           bool
+	dim            bool
+	underline      underlineStyle
+	blink          blinkSpeed
+	italic         bool
+	strike         bool
+	hidden         bool
+	overline       bool
+	framed         bool
+	encircled      bool
+	script         scriptPosition
+	font           int
+}
+
+// savedState is what DECSC saves besides the cursor position.
+type savedState struct {
+	attributes attributes
+	charsets   charsetState
 }
 
 type anchor struct {
@@ -54,6 +178,7 @@ type Converter struct {
 	minimumContrastRatio float64
 	isClass              bool
 	classPrefix          string
+	theme                palette
 	palette              palette
 	escapeHTML           bool
 	contrastCache        *contrastCache
@@ -62,33 +187,86 @@ type Converter struct {
 	isSpan               bool
 	styleChanged         bool
 	isAnchor             bool
+	anchorPending        bool
+	fonts                [11]string
+	blinkMode            BlinkMode
+	concealMode          ConcealMode
+	redactionMarker      string
+	redacting            bool
+	redacted             int
+	overstrikeMode       bool
+	overstrike           overstrike
+	parser               vtParser
+	charsets             charsetState
+	emulation            Emulation
+	screen               *screen
+	mainScreen           *screen
+	altScreen            *screen
+	altScreenPolicy      AltScreenPolicy
+	altBlocks            bytes.Buffer
+	columns              int
+	rows                 int
+	autoWrap             bool
+	clearPolicy          ClearPolicy
+	keepScreens          int
+	screenDirty          bool
+	screenIndex          int
+	screenBuffer         *screenBuffer
+	saved                *savedState
+	stringHandler        StringHandler
+	c1Mode               C1Mode
+	inputCharset         InputCharset
+	invalidUTF8          InvalidUTF8Policy
+	decoded              []rune
+	handlers             map[handlerKey]Handler
+	metadata             Metadata
+	commandBlocks        bool
+	command              *commandWriter
+	commandPart          commandPart
+	dcs                  *Sequence
+	dcsData              strings.Builder
+	cellAttributes       attributes
+	cellStyle            *spanStyle
+	cellAnchor           *anchor
 	attributes
 }
 
 func NewConverter(options ...Option) *Converter {
 	c := &Converter{
 		minimumContrastRatio: 3,
-		palette:              buildDefaultPalette(),
+		theme:                buildDefaultPalette(),
 		escapeHTML:           false,
 		isClass:              false,
 		classPrefix:          "ansi-",
 		contrastCache:        newContrastCache(),
 		styleChanged:         true,
+		fonts:                defaultFonts(),
+		redactionMarker:      "\u2022\u2022\u2022",
+		keepScreens:          1,
 		attributes: attributes{
 			fgIndexOrRgb: -1,
 			bgIndexOrRgb: -1,
+			ulIndexOrRgb: -1,
 			fgMode:       cmDEFAULT,
 			bgMode:       cmDEFAULT,
+			ulMode:       cmDEFAULT,
 			bold:         false,
 			dim:          false,
-			underline:    false,
-			blink:        false,
+			underline:    ulNone,
+			blink:        blinkNone,
 			inverse:      false,
 			italic:       false,
 			strike:       false,
 			hidden:       false,
+			overline:     false,
+			framed:       false,
+			encircled:    false,
+			script:       spBaseline,
+			font:         0,
 		},
 	}
+	c.palette = c.theme.clone()
+	c.charsets.reset()
 	c.ApplyOptions(options...)
 	return c
 }
@@ -106,71 +284,78 @@ func (c *Converter) Copy(dst io.Writer, src io.Reader) error {
 }
 
 func (c *Converter) CopyWithContext(ctx context.Context, dst io.Writer, src io.Reader) error {
-	w := bufio.NewWriter(dst)
+	if c.commandBlocks && c.emulation == Screen {
+		return fmt.Errorf("%w: command blocks in the Screen emulation", ErrNotSupported)
+	}
+	out := dst
+	c.screenBuffer = nil
+	if c.clearPolicy == ClearKeepLast {
+		c.screenBuffer = &screenBuffer{keep: c.keepScreens}
+		c.screenBuffer.next()
+		out = c.screenBuffer
+	}
+	c.command = nil
+	c.commandPart = cpNone
+	if c.commandBlocks {
+		c.command = &commandWriter{dst: out}
+		out = c.command
+	}
+	w := bufio.NewWriter(out)
 	r := bufio.NewReader(src)
+	c.parser.reset()
+	c.decoded = nil
+	c.screenDirty = false
+	c.screenIndex = 0
+	if c.clearPolicy == ClearSections {
+		if _, err := w.WriteString(c.sectionOpen()); err != nil {
+			return err
+		}
+	}
+	c.screen = nil
+	c.cellStyle = nil
+	c.cellAnchor = nil
+	c.autoWrap = true
+	switch {
+	case c.emulation == Screen:
+		cols, rows := c.columns, c.rows
+		if cols == 0 {
+			cols = defaultColumns
+		}
+		if rows == 0 {
+			rows = defaultRows
+		}
+		c.screen = newScreen(cols, rows, &tabStops{})
+	case c.emulation == LineBuffer || c.columns > 0:
+		c.screen = newScreen(c.columns, 1, &tabStops{})
+	}
+	c.mainScreen = c.screen
+	c.altScreen = nil
+	c.altBlocks.Reset()
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
-		char, _, err := r.ReadRune()
+		char, err := c.readRune(r)
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			return err
 		}
-		switch char {
-		case xESC:
-			nextChar, _, err := r.ReadRune()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return err
-			}
-			if nextChar == xLeftSquareBracket {
-				if err := c.readCSI(r); err != nil {
-					return err
-				}
-				c.styleChanged = true
-			} else if nextChar == xRightSquareBracket {
-				if err := c.readOSC(r, w); err != nil {
-					return err
-				}
-			} else if nextChar == xLeftRoundBracket {
-				if err := c.readAny(r); err != nil {
-					return err
-				}
-			}
-			// else {
-			// 	// not implement yet
-			// }
-			continue
-		case xCSI:
-			if err := c.readCSI(r); err != nil {
-				return err
-			}
-			c.styleChanged = true
-			continue
-		case xOSC:
-			if err := c.readOSC(r, w); err != nil {
-				return err
-			}
-			continue
-		}
-
-		switch char {
-		case xBS:
-			fallthrough
-		case xVT:
-			fallthrough
-		case xDEL:
-			continue
+		if err := c.parser.advance(c, w, char); err != nil {
+			return err
 		}
-
-		if err := c.writeRune(w, char); err != nil {
+	}
+	if err := c.flushOverstrike(w); err != nil {
+		return err
+	}
+	if err := c.endCommand(w, ""); err != nil {
+		return err
+	}
+	if c.screen != nil {
+		if err := c.flushScreen(w); err != nil {
 			return err
 		}
 	}
@@ -179,34 +364,62 @@ func (c *Converter) CopyWithContext(ctx context.Context, dst io.Writer, src io.R
 			return err
 		}
 	}
-	if c.isAnchor {
+	if c.isAnchor && !c.anchorPending {
 		if _, err := c.anchorClose(w); err != nil {
 			return err
 		}
 	}
-	return w.Flush()
+	if c.clearPolicy == ClearSections {
+		if _, err := w.WriteString("</section>"); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if c.screenBuffer != nil {
+		return c.screenBuffer.writeTo(c, dst)
+	}
+	return nil
 }
 
 func (c *Converter) Reset() {
+	c.palette = c.theme.clone()
 	c.contrastCache.Clear()
 	c.prevStyle = nil
 	c.prevAnchor = nil
 	c.styleChanged = true
 	c.isSpan = false
 	c.isAnchor = false
+	c.anchorPending = false
+	c.redacting = false
+	c.overstrike = overstrike{}
+	c.parser.reset()
+	c.charsets.reset()
+	c.saved = nil
+	c.dcs = nil
+	c.dcsData.Reset()
+	c.metadata = Metadata{}
 	c.attributes = attributes{
 		fgIndexOrRgb: -1,
 		bgIndexOrRgb: -1,
+		ulIndexOrRgb: -1,
 		fgMode:       cmDEFAULT,
 		bgMode:       cmDEFAULT,
+		ulMode:       cmDEFAULT,
 		bold:         false,
 		dim:          false,
-		underline:    false,
-		blink:        false,
+		underline:    ulNone,
+		blink:        blinkNone,
 		inverse:      false,
 		italic:       false,
 		strike:       false,
 		hidden:       false,
+		overline:     false,
+		framed:       false,
+		encircled:    false,
+		script:       spBaseline,
+		font:         0,
 	}
 }
 
@@ -230,43 +443,101 @@ func (c *Converter) gatherStyle() (*spanStyle, error) {
 
 	var err error
 	var foreground string
-	if c.isClass && fgMode != cmRGB {
+	fgIndex := fgColor
+	if fgMode == cmP16 && c.bold && fgIndex < 8 {
+		fgIndex += 8
+	}
+	if c.isClass && fgMode != cmRGB && !c.overridden(fgMode, fgIndex, !c.inverse) {
 		foreground = c.getForegroundClass(fgMode, fgColor)
 	} else {
 		foreground, err = c.getForegroundCSS(bgMode, bgColor, fgMode, fgColor)
+		if c.isClass {
+			fgMode = cmRGB
+		}
 	}
 	if err != nil {
 		return nil, err
 	}
 
 	var background string
-	if c.isClass && bgMode != cmRGB {
+	if c.isClass && bgMode != cmRGB && !c.overridden(bgMode, bgColor, c.inverse) {
 		background = c.getBackgroundClass(bgMode, bgColor)
 	} else {
 		background, err = c.getBackgroundCSS(bgMode, bgColor)
+		if c.isClass {
+			bgMode = cmRGB
+		}
 	}
 	if err != nil {
 		return nil, err
 	}
 
+	ulMode := c.ulMode
+	if ulMode == cmP256 && c.ulIndexOrRgb < 16 {
+		ulMode = cmP16
+	}
+	var underlineColor string
+	if c.underline != ulNone {
+		if c.isClass && ulMode != cmRGB && !c.overridden(ulMode, c.ulIndexOrRgb, true) {
+			underlineColor = c.getUnderlineClass(ulMode, c.ulIndexOrRgb)
+		} else {
+			underlineColor, err = c.getUnderlineCSS(ulMode, c.ulIndexOrRgb)
+			if c.isClass {
+				ulMode = cmRGB
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	style := &spanStyle{
-		fgMode:     fgMode,
-		foreground: foreground,
-		bgMode:     bgMode,
-		background: background,
-		bold:       c.bold,
-		dim:        c.dim,
-		italic:     c.italic,
-		underline:  c.underline,
-		blink:      c.blink,
-		hidden:     c.hidden,
-		strike:     c.strike,
+		fgMode:         fgMode,
+		foreground:     foreground,
+		bgMode:         bgMode,
+		background:     background,
+		ulMode:         ulMode,
+		underlineColor: underlineColor,
+		bold:           c.bold,
+		dim:            c.dim,
+		italic:         c.italic,
+		underline:      c.underline,
+		blink:          c.blink,
+		hidden:         c.hidden,
+		strike:         c.strike,
+		overline:       c.overline,
+		framed:         c.framed,
+		encircled:      c.encircled,
+		script:         c.script,
+		font:           c.font,
 	}
 
 	return style, nil
 }
 
+// backgroundStyle returns the current background color alone, or nil if
+// the background is the default one.
+func (c *Converter) backgroundStyle() (*spanStyle, error) {
+	if !c.inverse && c.bgMode == cmDEFAULT {
+		return nil, nil
+	}
+	style, err := c.gatherStyle()
+	if err != nil || style.background == "" {
+		return nil, err
+	}
+	return &spanStyle{bgMode: style.bgMode, background: style.background}, nil
+}
+
 func (c *Converter) writeRune(w writer, char rune) error {
+	if c.screen != nil {
+		return c.screenRune(w, char)
+	}
+	if c.anchorPending {
+		c.anchorPending = false
+		if _, err := c.anchorOpen(w, c.prevAnchor); err != nil {
+			return err
+		}
+	}
 	if c.styleChanged {
 		style, err := c.gatherStyle()
 		if err != nil {
@@ -308,9 +579,15 @@ func (c *Converter) equalStyle(a *spanStyle, b *spanStyle) bool {
 		a.dim == b.dim &&
 		a.italic == b.italic &&
 		a.underline == b.underline &&
+		a.underlineColor == b.underlineColor &&
 		a.blink == b.blink &&
 		a.hidden == b.hidden &&
-		a.strike == b.strike
+		a.strike == b.strike &&
+		a.overline == b.overline &&
+		a.framed == b.framed &&
+		a.encircled == b.encircled &&
+		a.script == b.script &&
+		a.font == b.font
 }
 
 func (c *Converter) needStyle(s *spanStyle) bool {
@@ -322,10 +599,15 @@ func (c *Converter) needStyle(s *spanStyle) bool {
 		s.bold ||
 		s.dim ||
 		s.italic ||
-		s.underline ||
-		(c.isClass && s.blink) ||
+		s.underline != ulNone ||
+		s.blink != blinkNone ||
 		s.hidden ||
-		s.strike
+		s.strike ||
+		s.overline ||
+		s.framed ||
+		s.encircled ||
+		s.script != spBaseline ||
+		(s.font != 0 && (c.isClass || c.fonts[s.font] != ""))
 }
 
 func (c *Converter) resetAttributes() {
@@ -336,16 +618,73 @@ func (c *Converter) resetAttributes() {
 	c.bold = false
 	c.dim = false
 	c.italic = false
-	c.underline = false
-	c.blink = false
+	c.underline = ulNone
+	c.ulIndexOrRgb = -1
+	c.ulMode = cmDEFAULT
+	c.blink = blinkNone
 	c.inverse = false
 	c.hidden = false
 	c.strike = false
+	c.overline = false
+	c.framed = false
+	c.encircled = false
+	c.script = spBaseline
+	c.font = 0
+}
+
+// fullReset handles RIS.
+func (c *Converter) fullReset(w writer) error {
+	if err := c.clearScreen(w); err != nil {
+		return err
+	}
+	c.softReset()
+	c.resetPalette()
+	if c.screen != nil {
+		return c.screenReset()
+	}
+	return c.hyperlink(w, "", "")
+}
+
+// softReset handles DECSTR, which keeps the screen and the cursor position.
+func (c *Converter) softReset() {
+	c.resetAttributes()
+	c.styleChanged = true
+	c.redacting = false
+	c.charsets.reset()
+	c.saved = nil
+	if c.screen != nil {
+		c.autoWrap = true
+		c.screen.top, c.screen.bottom = 0, c.screen.height-1
+		c.screen.saved = cursor{}
+	}
+}
+
+func (c *Converter) saveState() {
+	c.saved = &savedState{attributes: c.attributes, charsets: c.charsets}
+}
+
+func (c *Converter) restoreState() {
+	if c.saved == nil {
+		c.resetAttributes()
+		c.charsets.reset()
+	} else {
+		c.attributes = c.saved.attributes
+		c.charsets = c.saved.charsets
+	}
+	c.styleChanged = true
 }
 
-func (c *Converter) setAttributes(attrs []rune) {
-	for i := 0; i < len(attrs); i++ {
-		a := attrs[i]
+func (c *Converter) setAttributes(params [][]rune) {
+	hidden := c.hidden
+	defer func() {
+		// a new hidden run gets its own marker
+		if c.hidden != hidden {
+			c.redacting = false
+		}
+	}()
+	for i := 0; i < len(params); i++ {
+		a := params[i][0]
+		sub := params[i][1:]
 		switch a {
 		case yReset:
 			c.resetAttributes()
@@ -356,7 +695,12 @@ func (c *Converter) setAttributes(attrs []rune) {
 		case yItalic:
 			c.italic = true
 		case yUnderline:
-			c.underline = true
+			c.underline = ulSingle
+			if len(sub) > 0 && sub[0] <= rune(ulDashed) {
+				c.underline = underlineStyle(sub[0])
+			}
+		case yDoubleUnderline:
+			c.underline = ulDouble
 		case yInverse:
 			c.inverse = true
 		case yHidden:
@@ -364,10 +708,52 @@ func (c *Converter) setAttributes(attrs []rune) {
 		case yStrike:
 			c.strike = true
 		case ySlowBlink:
-			c.blink = true
+			c.blink = blinkSlow
 		case yRapidBlink:
+			c.blink = blinkRapid
+		case yNormalIntensity:
+			c.bold = false
+			c.dim = false
+		case yFraktur:
+			c.font = 10
+		case yNotItalic:
+			c.italic = false
+			if c.font == 10 {
+				c.font = 0
+			}
+		case yNotUnderline:
+			c.underline = ulNone
+		case yNotBlinking:
+			c.blink = blinkNone
+		case yNotInverse:
+			c.inverse = false
+		case yNotHidden:
+			c.hidden = false
+		case yNotStrike:
+			c.strike = false
+		case yFramed:
+			c.framed = true
+			c.encircled = false
+		case yEncircled:
+			c.encircled = true
+			c.framed = false
+		case yOverline:
+			c.overline = true
+		case yNotFramed:
+			c.framed = false
+			c.encircled = false
+		case yNotOverline:
+			c.overline = false
+		case ySuperscript:
+			c.script = spSuperscript
+		case ySubscript:
+			c.script = spSubscript
+		case yNotScript:
+			c.script = spBaseline
 		}
-		if a >= yFgBlack && a <= yFgWhite {
+		if a >= yPrimaryFont && a <= yAlternativeFont9 {
+			c.font = int(a - yPrimaryFont)
+		} else if a >= yFgBlack && a <= yFgWhite {
 			c.fgIndexOrRgb = a - yFgBlack
 			c.fgMode = cmP16
 		} else if a >= yBgBlack && a <= yBgWhite {
@@ -386,212 +772,315 @@ func (c *Converter) setAttributes(attrs []rune) {
 			c.bgIndexOrRgb = -1
 			c.bgMode = cmDEFAULT
 		} else if a == yFgExt {
-			if attrs[i+1] == 5 {
-				c.fgMode = cmP256
-				if i+2 >= len(attrs) {
-					c.fgIndexOrRgb = 0
-					break
-				}
-				c.fgIndexOrRgb = attrs[i+2]
-				i += 2
-			} else if attrs[i+1] == 2 {
-				c.fgMode = cmRGB
-				if i+4 >= len(attrs) {
-					c.fgIndexOrRgb = 0
-					break
-				}
-				c.fgIndexOrRgb = toRgb(attrs[i+2], attrs[i+3], attrs[i+4])
-
-				i += 4
+			mode, color, n, ok := extendedColor(params[i:])
+			if ok {
+				c.fgMode, c.fgIndexOrRgb = mode, color
 			}
+			i += n
 		} else if a == yBgExt {
-			if attrs[i+1] == 5 {
-				c.bgMode = cmP256
-				if i+2 >= len(attrs) {
-					c.bgIndexOrRgb = 0
-					break
-				}
-				c.bgIndexOrRgb = attrs[i+2]
-				i += 2
-			} else if attrs[i+1] == 2 {
-				c.bgMode = cmRGB
-				if i+4 >= len(attrs) {
-					c.bgIndexOrRgb = 0
-					break
-				}
-				c.bgIndexOrRgb = toRgb(attrs[i+2], attrs[i+3], attrs[i+4])
-				i += 4
+			mode, color, n, ok := extendedColor(params[i:])
+			if ok {
+				c.bgMode, c.bgIndexOrRgb = mode, color
+			}
+			i += n
+		} else if a == yUlExt {
+			mode, color, n, ok := extendedColor(params[i:])
+			if ok {
+				c.ulMode, c.ulIndexOrRgb = mode, color
 			}
+			i += n
+		} else if a == yUlReset {
+			c.ulIndexOrRgb = -1
+			c.ulMode = cmDEFAULT
 		}
 	}
 }
 
-func (c *Converter) readCSI(r io.RuneReader) (err error) {
-	isEnd := func(char rune) bool {
-		return char < 0x20 || char >= 0x40
+func (c *Converter) print(w writer, char rune) error {
+	c.screenDirty = true
+	char = c.charsets.translate(char)
+	if c.overstrikeMode {
+		return c.overstrikePrint(w, char)
 	}
-	var params []rune
-	var num rune
-	for {
-		code, _, err := r.ReadRune()
-		if err == io.EOF {
-			break
+	return c.printChar(w, char)
+}
+
+func (c *Converter) printChar(w writer, char rune) error {
+	if c.hidden && c.concealMode == ConcealRedact {
+		if c.screen != nil {
+			return c.redactCells(w, char)
 		}
-		if err != nil {
-			return err
+		if c.redacting {
+			return nil
 		}
-		if isEnd(code) {
-			params = append(params, num)
-			if code == xm {
-				c.setAttributes(params)
+		c.redacting = true
+		for _, r := range c.redactionMarker {
+			if err := c.writeRune(w, r); err != nil {
+				return err
 			}
-			break
-		}
-		if code == xSemiColon {
-			params = append(params, num)
-			num = 0
-		} else if code >= '0' && code <= '9' {
-			num = 10*num + (code - '0')
-		} else {
-			// return ErrNotSupported
-			continue
 		}
+		return nil
 	}
-	return
+	c.redacting = false
+	return c.writeRune(w, char)
 }
 
-func (c *Converter) readOSC(r io.RuneReader, w writer) (err error) {
-	var mode rune = -1
-	var paramsBuilder strings.Builder
-	var urlBuilder strings.Builder
-	state := 0
-	wrapSpan := func(cb func() error) (err error) {
-		if c.isSpan {
-			if _, err = c.spanClose(w); err != nil {
-				return
-			}
-			if err = cb(); err != nil {
-				return
-			}
-			if _, err = c.spanOpen(w, c.prevStyle); err != nil {
-				return
-			}
-			return
+// redactCells replaces each cell of a hidden run on the screen, so that the
+// run keeps its width: the marker is cut or padded with spaces.
+func (c *Converter) redactCells(w writer, char rune) error {
+	if !c.redacting {
+		c.redacting = true
+		c.redacted = 0
+	}
+	marker := []rune(c.redactionMarker)
+	for i := runeWidth(char); i > 0; i-- {
+		r := ' '
+		if c.redacted < len(marker) {
+			r = marker[c.redacted]
+		}
+		c.redacted++
+		if err := c.writeRune(w, r); err != nil {
+			return err
 		}
-		return cb()
 	}
+	return nil
+}
 
-	handle := func() {
-		url := urlBuilder.String()
-		defer func() {
-			c.isAnchor = url != ""
-		}()
-		if url != "" {
-			a := &anchor{
-				url:    url,
-				params: map[string]string{},
-			}
-
-			params := strings.Split(paramsBuilder.String(), ":")
-			for _, str := range params {
-				values := strings.Split(str, "=")
-				if len(values) == 2 {
-					a.params[values[0]] = values[1]
-				}
-			}
-
-			if c.prevAnchor != nil {
-				err = wrapSpan(func() error {
-					_, err := c.anchorNext(w, a)
-					return err
-				})
-				if err != nil {
-					return
-				}
-			} else {
-				err = wrapSpan(func() error {
-					_, err := c.anchorOpen(w, a)
-					return err
-				})
-				if err != nil {
-					return
-				}
-			}
-			c.prevAnchor = a
-			return
+func (c *Converter) execute(w writer, char rune) error {
+	if char == xBS && c.overstrikeBackspace() {
+		return nil
+	}
+	if err := c.flushOverstrike(w); err != nil {
+		return err
+	}
+	c.redacting = false
+	if c.screen != nil {
+		if err := c.screenExecute(w, char); err != nil {
+			return err
 		}
-		if !c.isAnchor {
-			return
+	}
+	switch char {
+	case xSO:
+		c.charsets.gl = 1
+	case xSI:
+		c.charsets.gl = 0
+	case xSS2:
+		c.charsets.single = 2
+	case xSS3:
+		c.charsets.single = 3
+	case xHT, xLF, xFF, xCR:
+		if c.screen == nil {
+			return c.writeRune(w, char)
 		}
-		err = wrapSpan(func() error {
-			_, err := c.anchorClose(w)
-			c.prevAnchor = nil
-			return err
-		})
 	}
+	return nil
+}
 
-	for {
-		code, _, err := r.ReadRune()
-		if err == io.EOF {
-			break
+func (c *Converter) escDispatch(w writer, seq *sequence) error {
+	if err := c.flushOverstrike(w); err != nil {
+		return err
+	}
+	if len(c.handlers) > 0 {
+		if ok, err := c.hook(w, int(seq.final), newSequence(ESC, seq)); ok || err != nil {
+			return err
 		}
-		if err != nil {
+	}
+	if c.charsets.designate(seq) || len(seq.intermediates) > 0 {
+		return nil
+	}
+	if c.screen != nil {
+		if err := c.screenESC(w, seq); err != nil {
 			return err
 		}
-		if code == xST || code == xBEL {
-			if mode == 8 {
-				handle()
-			}
-			break
+	}
+	switch seq.final {
+	case x7:
+		c.saveState()
+	case x8:
+		c.restoreState()
+	case xc:
+		return c.fullReset(w)
+	case xn:
+		c.charsets.gl = 2
+	case xo:
+		c.charsets.gl = 3
+	case xN:
+		c.charsets.single = 2
+	case xO:
+		c.charsets.single = 3
+	}
+	return nil
+}
+
+func (c *Converter) csiDispatch(w writer, seq *sequence) error {
+	if err := c.flushOverstrike(w); err != nil {
+		return err
+	}
+	if len(c.handlers) > 0 {
+		if ok, err := c.hook(w, int(seq.final), newSequence(CSI, seq)); ok || err != nil {
+			return err
 		}
-		if code == xESC {
-			code, _, err = r.ReadRune()
-			if err == io.EOF {
-				return ErrUnexpected
-			}
-			if err != nil {
+	}
+	if seq.private == 0 && string(seq.intermediates) == "!" && seq.final == xp {
+		c.softReset()
+		return nil
+	}
+	if seq.private != 0 || len(seq.intermediates) > 0 {
+		if c.screen != nil {
+			return c.screenCSI(w, seq)
+		}
+		return nil
+	}
+	switch seq.final {
+	case xm:
+		c.setAttributes(seq.params)
+		c.styleChanged = true
+	case xK:
+		if c.screen != nil {
+			return c.screenCSI(w, seq)
+		}
+		if mode := seq.param(0, 0); mode == 0 || mode == 2 {
+			style, err := c.backgroundStyle()
+			if err != nil || style == nil {
 				return err
 			}
-			if code == xBackslash {
-				if mode == 8 {
-					handle()
-				}
-				break
+			_, err = c.fill(w, style)
+			return err
+		}
+	case xJ:
+		if mode := seq.param(0, 0); mode == 2 || mode == 3 {
+			if err := c.clearScreen(w); err != nil {
+				return err
 			}
-			return ErrUnexpected
-		}
-		if code == xSemiColon {
-			state++
-		} else if state == 0 {
-			mode = code - '0'
-		} else if state == 1 {
-			_, _ = paramsBuilder.WriteRune(code)
-		} else if state == 2 {
-			_, _ = urlBuilder.WriteRune(code)
-		} else {
-			continue
+		}
+		if c.screen != nil {
+			return c.screenCSI(w, seq)
+		}
+	default:
+		if c.screen != nil {
+			return c.screenCSI(w, seq)
 		}
 	}
-	return
+	return nil
 }
 
-func (c *Converter) readAny(r io.RuneReader) (err error) {
-	isEnd := func(char rune) bool {
-		return char < 0x20 || char >= 0x40
+func (c *Converter) oscDispatch(w writer, data string) error {
+	if err := c.flushOverstrike(w); err != nil {
+		return err
 	}
-	for {
-		code, _, err := r.ReadRune()
-		if err == io.EOF {
-			break
+	if ok, err := c.hookOSC(w, data); ok || err != nil {
+		return err
+	}
+	args := strings.Split(data, ";")
+	mode, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil
+	}
+	var text string
+	if i := strings.IndexByte(data, ';'); i >= 0 {
+		text = data[i+1:]
+	}
+	switch mode {
+	case 0, 1, 2:
+		c.setTitle(mode, text)
+	case 7:
+		c.setCwd(text)
+	case 4, 104:
+		c.setPalette(mode, args[1:])
+	case 10, 11, 12:
+		c.setDynamicColor(mode, args[1:])
+	case 110, 111, 112:
+		c.resetDynamicColor(mode)
+	case 133:
+		return c.commandMark(w, args[1:])
+	case 8:
+		// the URL may hold semicolons of its own
+		args = strings.SplitN(data, ";", 3)
+		var params, url string
+		if len(args) > 1 {
+			params = args[1]
+		}
+		if len(args) > 2 {
+			url = args[2]
+		}
+		return c.hyperlink(w, params, url)
+	}
+	return nil
+}
+
+func (c *Converter) wrapSpan(w writer, cb func() error) (err error) {
+	if c.isSpan {
+		if _, err = c.spanClose(w); err != nil {
+			return
+		}
+		if err = cb(); err != nil {
+			return
+		}
+		if _, err = c.spanOpen(w, c.prevStyle); err != nil {
+			return
+		}
+		return
+	}
+	return cb()
+}
+
+func (c *Converter) hyperlink(w writer, params string, url string) (err error) {
+	if c.screen != nil {
+		c.cellAnchor = newAnchor(params, url)
+		return nil
+	}
+	if c.anchorPending {
+		// closed by markup, nothing to close again
+		c.anchorPending = false
+		c.isAnchor = false
+		c.prevAnchor = nil
+	}
+	defer func() {
+		c.isAnchor = url != ""
+	}()
+	if a := newAnchor(params, url); a != nil {
+		if c.prevAnchor != nil {
+			err = c.wrapSpan(w, func() error {
+				_, err := c.anchorNext(w, a)
+				return err
+			})
+		} else {
+			err = c.wrapSpan(w, func() error {
+				_, err := c.anchorOpen(w, a)
+				return err
+			})
 		}
 		if err != nil {
-			return err
+			return
 		}
-		if isEnd(code) {
-			break
+		c.prevAnchor = a
+		return
+	}
+	if !c.isAnchor {
+		return
+	}
+	return c.wrapSpan(w, func() error {
+		_, err := c.anchorClose(w)
+		c.prevAnchor = nil
+		return err
+	})
+}
+
+func newAnchor(params string, url string) *anchor {
+	if url == "" {
+		return nil
+	}
+	a := &anchor{
+		url:    url,
+		params: map[string]string{},
+	}
+	for _, str := range strings.Split(params, ":") {
+		values := strings.Split(str, "=")
+		if len(values) == 2 {
+			a.params[values[0]] = values[1]
 		}
 	}
-	return
+	return a
 }
 
 func (c *Converter) getForegroundRgb(fgColorMode colorMode, fgIndexOrRgb rune) (rune, error) {
@@ -751,6 +1240,34 @@ func (c *Converter) _getForegroundCSS(fgColorMode colorMode, fgIndexOrRgb rune)
 	return "", nil
 }
 
+func (c *Converter) getUnderlineCSS(ulColorMode colorMode, ulIndexOrRgb rune) (string, error) {
+	switch ulColorMode {
+	case cmP16:
+		fallthrough
+	case cmP256:
+		if int(ulIndexOrRgb) >= len(c.palette.colors) {
+			return "", fmt.Errorf("%w: %d", ErrColorUndefined, ulIndexOrRgb)
+		}
+		return c.palette.colors[ulIndexOrRgb].css, nil
+	case cmRGB:
+		return toCSS(ulIndexOrRgb), nil
+	}
+	return "", nil
+}
+
+func (c *Converter) getUnderlineClass(
+	ulColorMode colorMode,
+	ulIndexOrRgb rune,
+) string {
+	switch ulColorMode {
+	case cmP16:
+		fallthrough
+	case cmP256:
+		return strconv.FormatInt(int64(ulIndexOrRgb), 10)
+	}
+	return ""
+}
+
 func (c *Converter) getForegroundClass(
 	fgColorMode colorMode,
 	fgIndexOrRgb rune,
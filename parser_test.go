@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -91,7 +93,188 @@ func Test(t *testing.T) {
 	expect("\x1b[?1049hhelloworld", "helloworld")
 	expect("\x1b[20;3Hhelloworld", "helloworld")
 	expect("abcde\x1b]6;id=app;http://example.com\x1b\\", "abcde")
-	expect("\x1b]8;;;;http://example.com\x1b\\helloworld\x1b\\", "helloworld")
+	expect("\x1b]8;;;;http://example.com\x1b\\helloworld\x1b\\", `<a href=";;http://example.com" class="ansi-link">helloworld</a>`)
+	expect("\x1b]8;;http://example.com/a;b?c=1;d\x1b\\link\x1b]8;;\x1b\\", `<a href="http://example.com/a;b?c=1;d" class="ansi-link">link</a>`)
+}
+
+func TestParser(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetOptions(options))
+	expect := newExpect(t, c)
+
+	expect("hello\x1b_Gf=100;AAAA\x1b\\world", "helloworld")
+	expect("hello\x1bPq#0;2;0;0;0#1;2;100;100;0\x1b\\world", "helloworld")
+	expect("hello\x1b^private\x1b\\world", "helloworld")
+	expect("hello\x1bXstart of string\x1b\\world", "helloworld")
+	expect("hello\x1b]0;title\x07world", "helloworld")
+	expect("\x1b[?1;2c\x1b[>0;1c\x1b[1 q\x1b[!phelloworld", "helloworld")
+	expect("\x1b[3\x1b[31mhelloworld\x1b[m", `<span style="color:#e05561">helloworld</span>`)
+	expect("\x1b[31\x18mhelloworld", "mhelloworld")
+	expect("\x1b[3\nmhelloworld", "\n<span style=\"font-style:italic\">helloworld</span>")
+	expect("hello\x00\x07\x1b#8world\x1b(0\x1b)B", "helloworld")
+	expect("hello\x1b[1;2;3;4;5;6;7;8;9;10;11;12;13;14;15;16;17;18;19;20;21;22;23;24;25;26;27;28;29;30;31;32;33;34;35;36mworld", "helloworld")
+	expect("\x1b[99999999999999999999mhelloworld", "helloworld")
+}
+
+func TestSubParameters(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetOptions(options))
+	expect := newExpect(t, c)
+
+	expect("\x1b[38:2::255:0:0mhelloworld\x1b[m", `<span style="color:#ff0000">helloworld</span>`)
+	expect("\x1b[38:2:255:0:0mhelloworld\x1b[m", `<span style="color:#ff0000">helloworld</span>`)
+	expect("\x1b[38:2:0:1:2:3mhelloworld\x1b[m", `<span style="color:#010203">helloworld</span>`)
+	expect("\x1b[48:5:123mhelloworld\x1b[m", `<span style="background-color:#87ffff">helloworld</span>`)
+	expect("\x1b[38:5:2;1mhelloworld\x1b[m", `<span style="color:#a5e075;font-weight:bold">helloworld</span>`)
+	expect("\x1b[38:3::255:0:255mhelloworld\x1b[m", `<span style="color:#00ff00">helloworld</span>`)
+	expect("\x1b[38:4::0:255:255:0mhelloworld\x1b[m", `<span style="color:#ff0000">helloworld</span>`)
+	expect("\x1b[48:4:0:0:0:128mhelloworld\x1b[m", `<span style="background-color:#7f7f7f">helloworld</span>`)
+	expect("\x1b[31m\x1b[38:1mhelloworld\x1b[m", "helloworld")
+	expect("\x1b[38:2:1:2mhelloworld\x1b[m", `<span style="color:#000000">helloworld</span>`)
+	expect("\x1b[38:2::999:0:0mhelloworld\x1b[m", `<span style="color:#ff0000">helloworld</span>`)
+	expect("\x1b[4:3mhello\x1b[4:0mworld", `<span style="text-decoration:underline;text-decoration-style:wavy">hello</span>world`)
+	expect("\x1b[38mhello\x1b[48mworld\x1b[m", "helloworld")
+	expect("\x1b[38;9mhelloworld\x1b[m", "helloworld")
+	expect("\x1b[38:2:1:2:3;1mhelloworld\x1b[m", `<span style="color:#010203;font-weight:bold">helloworld</span>`)
+	expect("\x1b[38;2;1;2;3;1mhelloworld\x1b[m", `<span style="color:#010203;font-weight:bold">helloworld</span>`)
+}
+
+func TestUnderline(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetOptions(options))
+	expect := newExpect(t, c)
+	expect("\x1b[4:1mhelloworld\x1b[m", `<span style="text-decoration:underline">helloworld</span>`)
+	expect("\x1b[4:2mhelloworld\x1b[m", `<span style="text-decoration:underline;text-decoration-style:double">helloworld</span>`)
+	expect("\x1b[21mhelloworld\x1b[m", `<span style="text-decoration:underline;text-decoration-style:double">helloworld</span>`)
+	expect("\x1b[4:4;9mhelloworld\x1b[m", `<span style="text-decoration:underline line-through;text-decoration-style:dotted">helloworld</span>`)
+	expect("\x1b[4:5mhelloworld\x1b[m", `<span style="text-decoration:underline;text-decoration-style:dashed">helloworld</span>`)
+	expect("\x1b[4:3;58:2::255:0:0mhello\x1b[59mworld\x1b[m", `<span style="text-decoration:underline;text-decoration-color:#ff0000;text-decoration-style:wavy">hello</span><span style="text-decoration:underline;text-decoration-style:wavy">world</span>`)
+	expect("\x1b[58;5;1mhello\x1b[4mworld\x1b[m", `hello<span style="text-decoration:underline;text-decoration-color:#e05561">world</span>`)
+
+	c = ansihtml.NewConverter(ansihtml.SetMode(ansihtml.Class))
+	expect = newExpect(t, c)
+	expect("\x1b[4:3;58:5:1mhelloworld\x1b[m", `<span class="ansi-underline ansi-underline-curly ansi-ul-1">helloworld</span>`)
+	expect("\x1b[21;58:2::1:2:3mhelloworld\x1b[m", `<span class="ansi-underline ansi-underline-double" style="text-decoration-color:#010203">helloworld</span>`)
+}
+
+func TestResetAttributes(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetOptions(options))
+	expect := newExpect(t, c)
+	expect("\x1b[1mbold\x1b[22mnormal", `<span style="font-weight:bold">bold</span>normal`)
+	expect("\x1b[1;2mhello\x1b[22mworld", `<span style="font-weight:bold;opacity:0.5">hello</span>world`)
+	expect("\x1b[3mhello\x1b[23mworld", `<span style="font-style:italic">hello</span>world`)
+	expect("\x1b[4:3mhello\x1b[24mworld", `<span style="text-decoration:underline;text-decoration-style:wavy">hello</span>world`)
+	expect("\x1b[7;31mhello\x1b[27mworld", `<span style="background-color:#e05561">hello</span><span style="color:#e05561">world</span>`)
+	expect("\x1b[8mhello\x1b[28mworld", `<span style="opacity:0">hello</span>world`)
+	expect("\x1b[9mhello\x1b[29mworld", `<span style="text-decoration:line-through">hello</span>world`)
+	expect("\x1b[1;3;4;9mhello\x1b[22;24mworld\x1b[23;29m!", `<span style="font-style:italic;font-weight:bold;text-decoration:underline line-through">hello</span><span style="font-style:italic;text-decoration:line-through">world</span>!`)
+
+	c = ansihtml.NewConverter(ansihtml.SetMode(ansihtml.Class))
+	expect = newExpect(t, c)
+	expect("\x1b[5mhello\x1b[25mworld", `<span class="ansi-blink">hello</span>world`)
+}
+
+func TestDecorations(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetOptions(options))
+	expect := newExpect(t, c)
+	expect("\x1b[53mhello\x1b[55mworld", `<span style="text-decoration:overline">hello</span>world`)
+	expect("\x1b[4;53;9mhelloworld\x1b[m", `<span style="text-decoration:underline overline line-through">helloworld</span>`)
+	expect("\x1b[51mhello\x1b[54mworld", `<span style="outline:1px solid">hello</span>world`)
+	expect("\x1b[52mhello\x1b[54mworld", `<span style="border-radius:1em;outline:1px solid">hello</span>world`)
+	expect("\x1b[51;52mhelloworld\x1b[m", `<span style="border-radius:1em;outline:1px solid">helloworld</span>`)
+	expect("x\x1b[73m2\x1b[75m+y\x1b[74m1\x1b[m", `x<span style="font-size:smaller;vertical-align:super">2</span>+y<span style="font-size:smaller;vertical-align:sub">1</span>`)
+
+	c = ansihtml.NewConverter(ansihtml.SetMode(ansihtml.Class))
+	expect = newExpect(t, c)
+	expect("\x1b[53;9;51mhello\x1b[0;52;73mworld\x1b[m", `<span class="ansi-overline ansi-strike ansi-framed">hello</span><span class="ansi-encircled ansi-superscript">world</span>`)
+	expect("\x1b[74mhelloworld\x1b[m", `<span class="ansi-subscript">helloworld</span>`)
+}
+
+func TestFont(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetOptions(options), ansihtml.SetFont(1, "serif"), ansihtml.SetFont(3, "cursive"))
+	expect := newExpect(t, c)
+	expect("\x1b[11mhello\x1b[10mworld", `<span style="font-family:serif">hello</span>world`)
+	expect("\x1b[13;3mhello\x1b[12mworld\x1b[m", `<span style="font-family:cursive;font-style:italic">hello</span><span style="font-style:italic">world</span>`)
+	expect("\x1b[20mhello\x1b[23mworld", `<span style="font-family:UnifrakturMaguntia, UnifrakturCook, fantasy">hello</span>world`)
+	expect("\x1b[3;20mhello\x1b[11mworld\x1b[23m!", `<span style="font-family:UnifrakturMaguntia, UnifrakturCook, fantasy;font-style:italic">hello</span><span style="font-family:serif;font-style:italic">world</span><span style="font-family:serif">!</span>`)
+
+	c = ansihtml.NewConverter(ansihtml.SetOptions(ansihtml.Options{Mode: ansihtml.Class, ClassPrefix: "ansi-", Fonts: map[int]string{10: ""}}))
+	expect = newExpect(t, c)
+	expect("\x1b[12mhello\x1b[20mworld\x1b[m", `<span class="ansi-font-2">hello</span><span class="ansi-fraktur">world</span>`)
+}
+
+func TestBlink(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetOptions(options))
+	expect := newExpect(t, c)
+	expect("\x1b[5mhello\x1b[6mworld\x1b[25m!", `<span style="animation:ansi-blink 1s step-end infinite">hello</span><span style="animation:ansi-blink 0.4s step-end infinite">world</span>!`)
+	if css := c.Stylesheet(); !strings.Contains(css, "@keyframes ansi-blink") || !strings.Contains(css, "prefers-reduced-motion") {
+		t.Fatal(css)
+	}
+
+	c = ansihtml.NewConverter(ansihtml.SetOptions(options), ansihtml.SetBlinkMode(ansihtml.BlinkStatic))
+	expect = newExpect(t, c)
+	expect("\x1b[6mhelloworld\x1b[m", `<span style="text-shadow:0 0 0.25em currentColor">helloworld</span>`)
+	if css := c.Stylesheet(); strings.Contains(css, "@keyframes") {
+		t.Fatal(css)
+	}
+
+	c = ansihtml.NewConverter(ansihtml.SetMode(ansihtml.Class))
+	expect = newExpect(t, c)
+	expect("\x1b[5mhello\x1b[6mworld\x1b[m", `<span class="ansi-blink">hello</span><span class="ansi-rapid-blink">world</span>`)
+}
+
+func TestConceal(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetOptions(options), ansihtml.SetConcealMode(ansihtml.ConcealReveal))
+	expect := newExpect(t, c)
+	expect("token=\x1b[8;31msecret\x1b[28m!", `token=<span class="ansi-concealed" style="color:#e05561">secret</span><span style="color:#e05561">!</span>`)
+	if css := c.Stylesheet(); !strings.Contains(css, ".ansi-concealed:not(:hover)") {
+		t.Fatal(css)
+	}
+
+	c = ansihtml.NewConverter(ansihtml.SetOptions(options), ansihtml.SetConcealMode(ansihtml.ConcealRedact))
+	expect = newExpect(t, c)
+	expect("token=\x1b[8msecret\x1b[31mvalue\x1b[m!", `token=<span class="ansi-redacted">•••</span>!`)
+	expect("\x1b[8mab\x1b[28m\x1b[8mcd\x1b[m", `<span class="ansi-redacted">••••••</span>`)
+	expect("\x1b[8mab\ncd\x1b[m", "<span class=\"ansi-redacted\">\u2022\u2022\u2022\n\u2022\u2022\u2022</span>")
+	c.ApplyOptions(ansihtml.SetRedactionMarker("[redacted]"))
+	expect("token=\x1b[8msecret\x1b[m", `token=<span class="ansi-redacted">[redacted]</span>`)
+
+	c = ansihtml.NewConverter(ansihtml.SetConcealMode(ansihtml.ConcealRedact), ansihtml.SetEmulation(ansihtml.Screen))
+	expect = newExpect(t, c)
+	expect("\x1b[8mabcdef\x1b[0m|\x1b[1;8Hx", `<span class="ansi-redacted">•••   </span>|x`)
+	expect("\x1b[8mabcd\x1b[28m\x1b[8mef\x1b[m", `<span class="ansi-redacted">••• ••</span>`)
+	expect("\x1b[8mab\x1b[0m|\x1b[8m中\x1b[0m|", `<span class="ansi-redacted">••</span>|<span class="ansi-redacted">••</span>|`)
+
+	c = ansihtml.NewConverter(ansihtml.SetMode(ansihtml.Class), ansihtml.SetConcealMode(ansihtml.ConcealReveal))
+	expect = newExpect(t, c)
+	expect("\x1b[8msecret\x1b[m", `<span class="ansi-concealed">secret</span>`)
+}
+
+func TestCharset(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetOptions(options))
+	expect := newExpect(t, c)
+	expect("\x1b(0lqqk\nx  x\nmqqj\x1b(B", "┌──┐\n│  │\n└──┘")
+	expect("\x1b)0a\x0elqk\x0fb", "a┌─┐b")
+	expect("\x1b(A#1\x1b(B#2", "£1#2")
+	expect("\x1b*0\x1bNqq\x1b+0\u008fqq", "─q─q")
+	expect("\x1b*0\x1bnqq\x1b(B\x0fqq", "──qq")
+	expect("\x1b(KStra~e \x1b(R{t{", "Straße été")
+	expect("\x1b(%6[o\x1b(B", "Ão")
+	expect("\x1b-A\x0ei\x0f", "é")
+	expect("\x1b(0\x1b[31mx\x1b[m", `<span style="color:#e05561">│</span>`)
+}
+
+func TestOverstrike(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetOptions(options), ansihtml.SetOverstrike(true))
+	expect := newExpect(t, c)
+	expect("b\bbo\bol\bld\bd plain", `<span style="font-weight:bold">bold</span> plain`)
+	expect("_\bu_\bn_\bd_\be_\br line", `<span style="text-decoration:underline">under</span> line`)
+	expect("a\b_b", `<span style="text-decoration:underline">a</span>b`)
+	expect("_\bx\bx", `<span style="font-weight:bold;text-decoration:underline">x</span>`)
+	expect("NAME\n       l\bls\bs - list", "NAME\n       <span style=\"font-weight:bold\">ls</span> - list")
+	expect("\x1b[31mr\brx\x1b[m", `<span style="color:#ff616e;font-weight:bold">r</span><span style="color:#e05561">x</span>`)
+	expect("a\bb", "b")
+	expect("\ba", "a")
+
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetOptions(options)))
+	expect("b\bbo\bo", "bboo")
 }
 
 func TestC1(t *testing.T) {
@@ -140,7 +323,7 @@ func TestOtherInline(t *testing.T) {
 	expect("\x1b[38;2;2;4;6mhelloworld\x1b[m", `<span style="color:#020406">helloworld</span>`)
 	expect("\x1b]8;;http://example.com\x1b\\This is a link", `<a href="http://example.com" class="ansi-link">This is a link</a>`)
 	expect("\x1b[2;31;41mhelloworld\x1b[m", `<span style="background-color:#e05561;color:#fcdfe380">helloworld</span>`)
-	expect("\x1b[2;3;4;5;7;8;9mhelloworld\x1b[m", `<span style="font-style:italic;opacity:0;text-decoration:underline line-through">helloworld</span>`)
+	expect("\x1b[2;3;4;5;7;8;9mhelloworld\x1b[m", `<span style="animation:ansi-blink 1s step-end infinite;font-style:italic;opacity:0;text-decoration:underline line-through">helloworld</span>`)
 	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetTheme(ansihtml.Theme{Foreground: "#eee"})))
 	expect("\x1b[2;41mhelloworld\x1b[m", `<span style="background-color:#e05561;color:#eeeeee80">helloworld</span>`)
 }
@@ -214,3 +397,416 @@ func TestExample(t *testing.T) {
 		return
 	}
 }
+
+func TestLineBuffer(t *testing.T) {
+	expect := newExpect(t, ansihtml.NewConverter(ansihtml.SetEmulation(ansihtml.LineBuffer)))
+	expect("10%\r50%\r\x1b[K100%\n", "100%\n")
+	expect("[==  ]\r[====]\ndone", "[====]\ndone")
+	expect("\x1b[32mhello\x1b[m world\r\x1b[31mHELLO\x1b[m", `<span style="color:#e05561">HELLO</span> world`)
+	expect("hello world\r\x1b[2Kbye", "bye")
+	expect("hello world\b\b\b\b\b\b\x1b[1K!", "     !world")
+	expect("hello\b\b\b\x1b[Kp", "hep")
+	expect("ab\bc", "ac")
+	expect("a\tb", "a       b")
+	expect("\x1b]8;;http://example.com\x1b\\link\rL\x1b]8;;\x1b\\", `<a href="http://example.com" class="ansi-link">Link</a>`)
+	expect("one\ntwo\n\n", "one\ntwo\n\n")
+	expect("abc\x1b[2G\x1b[2@d", "ad bc")
+}
+
+func TestLineBufferLimit(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetEmulation(ansihtml.LineBuffer))
+	for _, input := range []string{
+		"x" + strings.Repeat("\x1b[1G\x1b[65535@", 300),
+		strings.Repeat("\x1b[65535Cx\n", 20),
+		"\x1b[41m" + strings.Repeat("\x1b[65535X\n", 20),
+	} {
+		buf := &bytes.Buffer{}
+		if err := c.Copy(buf, strings.NewReader(input)); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() > 64*1024 {
+			t.Errorf("%d bytes of output for %d bytes of input", buf.Len(), len(input))
+		}
+	}
+	expect := newExpect(t, c)
+	expect(strings.Repeat("-", 2000)+"\r\x1b[3000Cx\x1b[Cy", strings.Repeat("-", 1999)+"xy")
+}
+
+func TestScreen(t *testing.T) {
+	expect := newExpect(t, ansihtml.NewConverter(
+		ansihtml.SetEmulation(ansihtml.Screen),
+		ansihtml.SetScreenSize(10, 3),
+	))
+	expect("\x1b[2J\x1b[Hhello\x1b[2;3Hworld", "hello\n  world")
+	expect("abc\x1b[2Dx\x1b[Cy", "axcy")
+	expect("abc\x1b[Bd\x1b[Ae", "abc e\n   d")
+	expect("\x1b[3;1Hbottom\x1b[1;5Htop\x1b[3dV\x1b[5GX", "    top\n\nbottXm V")
+	expect("0123456789ABC", "0123456789\nABC")
+	expect("\x1b[?7l0123456789ABC", "012345678C")
+	expect("abcdef\x1b[3G\x1b[2P", "abef")
+	expect("abcdef\x1b[3G\x1b[2@", "ab  cdef")
+	expect("abcdef\x1b[3G\x1b[2X", "ab  ef")
+	expect("one\ntwo\nthree\x1b[2;1H\x1b[L", "one\n\ntwo")
+	expect("one\ntwo\nthree\x1b[1;1H\x1b[M", "two\nthree")
+	expect("one\ntwo\nthree\x1b[2;2H\x1b[J", "one\nt")
+	expect("one\ntwo\nthree\x1b[2;2H\x1b[1J", "\n  o\nthree")
+	expect("abc\x1b7\x1b[3;5Hx\x1b8d", "abcd\n\n    x")
+	expect("abc\x1b[s\x1b[3;5Hx\x1b[ud", "abcd\n\n    x")
+	expect("one\ntwo\nthree\nfour", "one\ntwo\nthree\nfour")
+	expect("\x1b[31mred\x1b[m\x1b[1;2Hx", `<span style="color:#e05561">r</span>x<span style="color:#e05561">d</span>`)
+}
+
+func TestAltScreen(t *testing.T) {
+	session := "$ less\n\x1b[?1049h\x1b[Hpage 1\x1b[2J\x1b[Hpage 2\x1b[?1049l$ done"
+	expect := newExpect(t, ansihtml.NewConverter(
+		ansihtml.SetEmulation(ansihtml.Screen),
+		ansihtml.SetScreenSize(10, 3),
+	))
+	expect(session, "$ less\n$ done")
+	expect("one\n\x1b[?47hx\x1b[?47l\x1b[?47hy", "one\n")
+	expect = newExpect(t, ansihtml.NewConverter(
+		ansihtml.SetEmulation(ansihtml.Screen),
+		ansihtml.SetScreenSize(10, 3),
+		ansihtml.SetAltScreenPolicy(ansihtml.AltScreenOnly),
+	))
+	expect(session, `<div class="ansi-alt-screen">page 2</div>`)
+	expect = newExpect(t, ansihtml.NewConverter(
+		ansihtml.SetEmulation(ansihtml.Screen),
+		ansihtml.SetScreenSize(10, 3),
+		ansihtml.SetAltScreenPolicy(ansihtml.AltScreenBoth),
+	))
+	expect(session, `$ less`+"\n"+`$ done<div class="ansi-alt-screen">page 2</div>`)
+	expect("\x1b[?1049ha\x1b[?1049l\x1b[?1049hb\x1b[3;1Hc", `<div class="ansi-alt-screen">a</div><div class="ansi-alt-screen">b`+"\n\n"+`c</div>`)
+	expect("\x1b[?47ha\x1b[?47l\x1b[?47h\x1b[Cb", `<div class="ansi-alt-screen">a</div><div class="ansi-alt-screen">a b</div>`)
+}
+
+func TestScrollRegion(t *testing.T) {
+	expect := newExpect(t, ansihtml.NewConverter(
+		ansihtml.SetEmulation(ansihtml.Screen),
+		ansihtml.SetScreenSize(10, 4),
+	))
+	expect("head\x1b[2;3r\x1b[2;1Ha\nb\nc\nd\x1b[r\x1b[4;1Hfoot", "head\nc\nd\nfoot")
+	expect("one\ntwo\nthree\nfour\nfive", "one\ntwo\nthree\nfour\nfive")
+	expect("one\ntwo\x1b[2;3r\x1b[2;1H\x1bMx", "one\nx\ntwo")
+	expect("one\ntwo\x1bDx", "one\ntwo\n   x")
+	expect("one\ntwo\x1bEx", "one\ntwo\nx")
+	expect("one\ntwo\x1b[2;1H\u008dx\u0084y\u0085z", "xne\ntyo\nz")
+	expect("a\nb\nc\nd\x1b[2S", "a\nb\nc\nd\n\n")
+	expect("a\nb\nc\nd\x1b[2T", "\n\na\nb")
+	expect("a\nb\nc\nd\x1b[2;3r\x1b[2;1H\x1b[L", "a\n\nb\nd")
+	expect("a\nb\nc\nd\x1b[2;3r\x1b[2;1H\x1b[M", "a\nc\n\nd")
+}
+
+func TestColumns(t *testing.T) {
+	expect := newExpect(t, ansihtml.NewConverter(ansihtml.SetColumns(6)))
+	expect("hello world", "hello \nworld")
+	expect("\x1b[31mabcdefgh\x1b[m", `<span style="color:#e05561">abcdef</span>`+"\n"+`<span style="color:#e05561">gh</span>`)
+	expect("中文字幕測試", "中文字\n幕測試")
+	expect("a中文字幕", "a中文\n字幕")
+	expect("e\u0301e\u0301e\u0301e\u0301e\u0301e\u0301e\u0301", "e\u0301e\u0301e\u0301e\u0301e\u0301e\u0301\ne\u0301")
+	expect("👍👍👍👍", "👍👍👍\n👍")
+	expect("中文\b\bx", "中x ")
+	expect("abc\rxyz\x1b[?7l\r中文字幕", "中文幕")
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetColumns(1)))
+	expect("中文", " \n ")
+	expect("a中", "a\n ")
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetEmulation(ansihtml.LineBuffer)))
+	expect("中\tx", "中      x")
+	expect("a\tb\tc", "a       b       c")
+	expect("\x1b[3g\x1b[5G\x1bH\x1b[9G\x1bH\ra\tb\tc\td", "a   b   cd")
+	expect("\x1b[2I.\x1b[2Z|", "        |       .")
+	expect("\x1b[5G\x1bH\x1b[1G\x1b[2I.\x1b[2Z|", "    |   .")
+	expect("\x1b[9G\x1b[g\ra\tb", "a               b")
+}
+
+func TestBackgroundErase(t *testing.T) {
+	fill := `<span style="background-color:#4aa5f0;display:inline-block;margin-right:-100vw;width:100vw"> </span>`
+	expect := newExpect(t, ansihtml.NewConverter())
+	expect("\x1b[44m PASS \x1b[K\x1b[m", `<span style="background-color:#4aa5f0"> PASS `+fill+`</span>`)
+	expect("\x1b[44m\x1b[2K\x1b[m", fill)
+	expect("plain\x1b[K", "plain")
+	expect("\x1b[44m\x1b[1K\x1b[m", "")
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetEmulation(ansihtml.LineBuffer)))
+	expect("\x1b[44m PASS \x1b[K\x1b[m\n", `<span style="background-color:#4aa5f0"> PASS </span>`+fill+"\n")
+	expect("old text\r\x1b[44mnew\x1b[K\x1b[m", `<span style="background-color:#4aa5f0">new</span>`+fill)
+	expect("\x1b[44mab\x1b[K\x1b[mcd", `<span style="background-color:#4aa5f0">ab</span>cd`)
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetColumns(6)))
+	expect("\x1b[44mab\x1b[K\x1b[m", `<span style="background-color:#4aa5f0">ab    </span>`)
+	expect("abcdef\x1b[3G\x1b[44m\x1b[2X\x1b[m", `ab<span style="background-color:#4aa5f0">  </span>ef`)
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetMode(ansihtml.Class)))
+	expect("\x1b[44mab\x1b[K", `<span class="ansi-bg-4">ab<span class="ansi-fill ansi-bg-4"> </span></span>`)
+	expect("\x1b[48;2;1;2;3m\x1b[K", `<span class="ansi-fill" style="background-color:#010203"> </span>`)
+	if css := ansihtml.NewConverter().Stylesheet(); !strings.Contains(css, ".ansi-fill {") {
+		t.Error("missing fill rule")
+	}
+}
+
+func TestClearScreen(t *testing.T) {
+	watch := "\x1b[2J\x1b[Hbuild 1\n\x1b[3J\x1b[H\x1b[2J\x1b[32mbuild 2\n\x1b[m\x1bcbuild 3"
+	expect := newExpect(t, ansihtml.NewConverter())
+	expect(watch, "build 1\n"+`<span style="color:#8cc265">build 2`+"\n</span>build 3")
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetClearPolicy(ansihtml.ClearSeparator)))
+	expect(watch, "build 1\n"+`<hr class="ansi-screen-separator"><span style="color:#8cc265">build 2`+"\n"+`</span><hr class="ansi-screen-separator">build 3`)
+	expect("\x1b]8;;http://example.com\x1b\\a\x1b[2Jb", `<a href="http://example.com" class="ansi-link">a</a><hr class="ansi-screen-separator"><a href="http://example.com" class="ansi-link">b</a>`)
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetClearPolicy(ansihtml.ClearSections)))
+	expect(watch, `<section class="ansi-screen" data-index="0">build 1`+"\n"+`</section><section class="ansi-screen" data-index="1"><span style="color:#8cc265">build 2`+"\n"+`</span></section><section class="ansi-screen" data-index="2">build 3</section>`)
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetClearPolicy(ansihtml.ClearKeepLast), ansihtml.SetKeepScreens(2)))
+	expect(watch, `<span style="color:#8cc265">build 2`+"\n"+`</span><hr class="ansi-screen-separator">build 3`)
+	expect("\x1b[2Jonly", "only")
+	expect = newExpect(t, ansihtml.NewConverter(
+		ansihtml.SetEmulation(ansihtml.Screen),
+		ansihtml.SetScreenSize(10, 3),
+		ansihtml.SetClearPolicy(ansihtml.ClearSeparator),
+	))
+	expect("\x1b[Hframe 1\x1b[2J\x1b[Hframe 2", `frame 1<hr class="ansi-screen-separator">frame 2`)
+	expect("\x1b[?1049h\x1b[Ha\x1b[2J\x1b[Hb\x1b[?1049lc", "c")
+}
+
+func TestTerminalReset(t *testing.T) {
+	expect := newExpect(t, ansihtml.NewConverter())
+	expect("\x1b[1;31mred\x1bcplain", `<span style="color:#ff616e;font-weight:bold">red</span>plain`)
+	expect("\x1b(0q\x1bcq", "─q")
+	expect("\x1b]8;;http://example.com\x1b\\link\x1bcplain", `<a href="http://example.com" class="ansi-link">link</a>plain`)
+	expect("\x1b[4mu\x1b[!pplain", `<span style="text-decoration:underline">u</span>plain`)
+	expect("\x1b)0\x0eq\x1b[!pq", "─q")
+	expect("\x1b[31ma\x1b7\x1b[1;4mb\x1b8c\x1b[m", `<span style="color:#e05561">a</span><span style="color:#ff616e;font-weight:bold;text-decoration:underline">b</span><span style="color:#e05561">c</span>`)
+	expect("\x1b(0\x1b7\x1b(Bq\x1b8q", "q─")
+	expect("\x1b[31ma\x1b8b", `<span style="color:#e05561">a</span>b`)
+	expect("\x1b[31m\x1b(0\x1b7\x1b[!p\x1b8q", "q")
+	expect = newExpect(t, ansihtml.NewConverter(
+		ansihtml.SetEmulation(ansihtml.Screen),
+		ansihtml.SetScreenSize(10, 3),
+	))
+	expect("one\ntwo\x1bcx", "x")
+	expect("\x1b[?1049halt\x1bcmain", "main")
+	expect("\x1b[2;3r\x1b[?7l\x1b[1;5Hab\x1b[!p\x1b[3;9Hcdef", "    ab\n\n        cd\nef")
+	expect("ab\x1b[31m\x1b7\x1b[2;3H\x1b[mc\x1b8d", "ab<span style=\"color:#e05561\">d</span>\n  c")
+}
+
+func TestControlStrings(t *testing.T) {
+	var got []ansihtml.Sequence
+	c := ansihtml.NewConverter(ansihtml.SetStringHandler(func(seq *ansihtml.Sequence) error {
+		got = append(got, *seq)
+		return nil
+	}))
+	expect := newExpect(t, c)
+	expect("a\x1b_bk;t=1700000000\x1b\\b", "ab")
+	expect("a\x1bP1;2$qm\x1b\\b", "ab")
+	expect("a\x1bXsos\x07b\x1b^pm\u009cc", "abc")
+	expect("a\u009fGf=100;AAAA\u009cb\u0090+q544e\x07c", "abc")
+	expect("a\x1bP1:2pignored\x1b\\b", "ab")
+	want := []ansihtml.Sequence{
+		{Kind: ansihtml.APC, Data: "bk;t=1700000000"},
+		{Kind: ansihtml.DCS, Intermediates: "$", Params: [][]int{{1}, {2}}, Final: 'q', Data: "m"},
+		{Kind: ansihtml.SOS, Data: "sos"},
+		{Kind: ansihtml.PM, Data: "pm"},
+		{Kind: ansihtml.APC, Data: "Gf=100;AAAA"},
+		{Kind: ansihtml.DCS, Intermediates: "+", Params: [][]int{{0}}, Final: 'q', Data: "544e"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, received %+v", want, got)
+	}
+	if got[1].Param(1, 0) != 2 || got[1].Param(2, 7) != 7 {
+		t.Error("unexpected params")
+	}
+}
+
+func TestTmuxPassthrough(t *testing.T) {
+	var got []ansihtml.Sequence
+	expect := newExpect(t, ansihtml.NewConverter(ansihtml.SetStringHandler(func(seq *ansihtml.Sequence) error {
+		got = append(got, *seq)
+		return nil
+	})))
+	expect("\x1bPtmux;\x1b\x1b]8;;http://example.com\x1b\x1b\\\x1b\\link\x1bPtmux;\x1b\x1b]8;;\x1b\x1b\\\x1b\\", `<a href="http://example.com" class="ansi-link">link</a>`)
+	expect("\x1bPtmux;\x1b\x1b[31m\x1b\\red\x1b[m", `<span style="color:#e05561">red</span>`)
+	expect("\x1bPtmux;\x1b\x1b_Ga=T\x1b\x1b\\\x1b\\ok", "ok")
+	expect("\x1bPtmp;x\x1b\\ok", "ok")
+	expect("\x1bPtmux;\x1b\x1b(0\x1b\\q", "─")
+	want := []ansihtml.Sequence{
+		{Kind: ansihtml.APC, Data: "Ga=T"},
+		{Kind: ansihtml.DCS, Params: [][]int{{0}}, Final: 't', Data: "mp;x"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, received %+v", want, got)
+	}
+}
+
+func TestC1Mode(t *testing.T) {
+	expect := newExpect(t, ansihtml.NewConverter())
+	expect("\u009b31mred\u009bm", `<span style="color:#e05561">red</span>`)
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetC1Mode(ansihtml.C1Ignored)))
+	expect("\u009b31mred\u009bm", "31mredm")
+	expect("\x1b[31mred\x1b[m", `<span style="color:#e05561">red</span>`)
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetC1Mode(ansihtml.C1Raw)))
+	expect("\x9b31mred\x9bm café 中", `<span style="color:#e05561">red</span> café 中`)
+	expect("caf\xe9\xc2\x9b31mx", `caf�<span style="color:#e05561">x</span>`)
+	expect("\x9d8;;http://example.com\x9clink\x9d8;;\x9c", `<a href="http://example.com" class="ansi-link">link</a>`)
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetC1Mode(ansihtml.C1Raw), ansihtml.SetInputCharset(ansihtml.CP437)))
+	expect("\x9b31m\x80x\xb0", `<span style="color:#e05561">x░</span>`)
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetC1Mode(ansihtml.C17Bit)))
+	expect("\x9b31m\x1b[31mcafé\x1b[m", `�31m<span style="color:#e05561">café</span>`)
+	expect("\xc2\x9b31m", "�31m")
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetC1Mode(ansihtml.C17Bit), ansihtml.SetInputCharset(ansihtml.Latin1)))
+	expect("caf\xe9\x9b31m", "café�31m")
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetC1Mode(ansihtml.C17Bit), ansihtml.SetInvalidUTF8Policy(ansihtml.InvalidEscape)))
+	expect("\xc2\x9b31m\x9b", `�31m\x9B`)
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetC1Mode(ansihtml.C17Bit), ansihtml.SetInvalidUTF8Policy(ansihtml.InvalidLatin1)))
+	expect("a\x9bb", "ab")
+}
+
+func TestInputCharset(t *testing.T) {
+	expect := newExpect(t, ansihtml.NewConverter())
+	expect("caf\xe9 \xff", "caf� �")
+	expect("�", "�")
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetInvalidUTF8Policy(ansihtml.InvalidEscape)))
+	expect("caf\xe9 ok\xc3", `caf\xE9 ok\xC3`)
+	expect("\x1b[31m\xff\x1b[m", `<span style="color:#e05561">\xFF</span>`)
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetInvalidUTF8Policy(ansihtml.InvalidLatin1)))
+	expect("caf\xe9 café", "café café")
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetInvalidUTF8Policy(ansihtml.InvalidCP437)))
+	expect("\xb0\xb1\xb2 中", "░▒▓ 中")
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetInputCharset(ansihtml.CP437)))
+	expect("\xc9\xcd\xbb\n\xba\x1b[32m\x80\x1b[m\xba", "╔═╗\n║"+`<span style="color:#8cc265">Ç</span>`+"║")
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetInputCharset(ansihtml.Latin1)))
+	expect("caf\xe9 \xc3\xa9", "café Ã©")
+}
+
+func TestHandler(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetEscapeHTML(true))
+	c.Handle(ansihtml.OSC, 1337, func(out ansihtml.Output, seq *ansihtml.Sequence) error {
+		return out.WriteHTML(`<span data-step="` + seq.Data + `"></span>`)
+	})
+	c.Handle(ansihtml.CSI, 'z', func(out ansihtml.Output, seq *ansihtml.Sequence) error {
+		if seq.Private != '>' {
+			return ansihtml.ErrNotSupported
+		}
+		if err := out.SetAttributes(1, 32); err != nil {
+			return err
+		}
+		return out.WriteText("<" + strconv.Itoa(seq.Param(0, 0)) + seq.Intermediates + ">")
+	})
+	c.Handle(ansihtml.APC, 0, func(out ansihtml.Output, seq *ansihtml.Sequence) error {
+		return out.WriteText("[" + seq.Data + "]")
+	})
+	c.Handle(ansihtml.DCS, 'q', func(out ansihtml.Output, seq *ansihtml.Sequence) error {
+		return out.WriteText(seq.Data)
+	})
+	c.Handle(ansihtml.ESC, 'c', func(out ansihtml.Output, seq *ansihtml.Sequence) error {
+		return nil
+	})
+	expect := newExpect(t, c)
+	expect("a\x1b]1337;build\x07b", `a<span data-step="build"></span>b`)
+	expect("\x1b[>7 zx\x1b[m", `<span style="color:#a5e075;font-weight:bold">&lt;7 &gt;x</span>`)
+	expect("\x1b[7zx", "x")
+	expect("\x1b_hi\x1b\\\x1bPsixel\x1b\\\x1bP1qdata\x1b\\", "[hi]data")
+	expect("\x1b[1mbold\x1bcbold", `<span style="font-weight:bold">boldbold</span>`)
+	c.Handle(ansihtml.ESC, 'c', nil)
+	expect("\x1b[1mbold\x1bcplain", `<span style="font-weight:bold">bold</span>plain`)
+	c.ApplyOptions(ansihtml.SetEmulation(ansihtml.LineBuffer))
+	expect("abc\r\x1b]1337;x\x07X", `<span data-step="x"></span>Xbc`)
+	expect("abc\x1b]1337;end\x07", `abc<span data-step="end"></span>`)
+}
+
+func TestMetadata(t *testing.T) {
+	c := ansihtml.NewConverter()
+	expect := newExpect(t, c)
+	expect("\x1b]0;vim\x07a\x1b]2;make; test\x1b\\\x1b]1;icon\x07\x1b]7;file://box/home/me%20too\x07b", "ab")
+	m := c.Metadata()
+	if !reflect.DeepEqual(m.Titles, []string{"vim", "make; test"}) || m.Title() != "make; test" {
+		t.Errorf("titles: %q", m.Titles)
+	}
+	if !reflect.DeepEqual(m.IconNames, []string{"vim", "icon"}) {
+		t.Errorf("icon names: %q", m.IconNames)
+	}
+	if m.Host != "box" || m.Cwd != "/home/me too" {
+		t.Errorf("cwd: %q %q", m.Host, m.Cwd)
+	}
+	c.Reset()
+	if m := c.Metadata(); m.Title() != "" || m.Cwd != "" {
+		t.Errorf("reset: %+v", m)
+	}
+}
+
+func TestPaletteChange(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetTheme(ansihtml.Theme{Red: "#ff0000"}))
+	expect := newExpect(t, c)
+	expect("\x1b[31ma\x1b]4;1;rgb:00/80/ff\x07b\x1b]104;1\x07c", `<span style="color:#ff0000">a</span><span style="color:#0080ff">b</span><span style="color:#ff0000">c</span>`)
+	expect("\x1b]4;1;#fff;2;?;3;#000080008000\x1b\\\x1b[31ma\x1b[33mb", `<span style="color:#ffffff">a</span><span style="color:#008080">b</span>`)
+	expect("\x1b[31ma", `<span style="color:#ff0000">a</span>`)
+	expect("\x1b]10;#fff;#000\x07a\x1b[7mb\x1b]110\x07c", `<span style="background-color:#000000;color:#ffffff">a</span><span style="background-color:#ffffff;color:#000000">b</span><span style="color:#000000">c</span>`)
+	expect("\x1b]4;1;#00f\x07\x1b[31ma\x1bcb\x1b[31mc", `<span style="color:#0000ff">a</span>b<span style="color:#ff0000">c</span>`)
+
+	c = ansihtml.NewConverter(ansihtml.SetMode(ansihtml.Class))
+	expect = newExpect(t, c)
+	expect("\x1b[31;42ma\x1b]4;1;#00f\x07b\x1b]104\x07c", `<span class="ansi-fg-1 ansi-bg-2">a</span><span class="ansi-bg-2" style="color:#0000ff">b</span><span class="ansi-fg-1 ansi-bg-2">c</span>`)
+	expect("\x1b]11;#111\x07a\x1b[7mb", `<span style="background-color:#111111">a</span><span class="ansi-bg-inverse" style="color:#111111">b</span>`)
+
+	for _, emulation := range []ansihtml.Emulation{ansihtml.LineBuffer, ansihtml.Screen} {
+		expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetEmulation(emulation)))
+		expect("\x1b[31ma\x1b]4;1;#00ff00\x07b\x1b]104\x07c", `<span style="color:#e05561">a</span><span style="color:#00ff00">b</span><span style="color:#e05561">c</span>`)
+		expect("\x1b]10;#fff\x07a\x1b]110\x07b", `<span style="color:#ffffff">a</span>b`)
+	}
+	expect = newExpect(t, ansihtml.NewConverter(ansihtml.SetColumns(10), ansihtml.SetMode(ansihtml.Class)))
+	expect("\x1b[31ma\x1b]4;1;#00ff00\x07b", `<span class="ansi-fg-1">a</span><span style="color:#00ff00">b</span>`)
+}
+
+func TestCommandBlocks(t *testing.T) {
+	c := ansihtml.NewConverter(ansihtml.SetCommandBlocks(true))
+	expect := newExpect(t, c)
+	expect("motd\n\x1b]133;A\x07$ \x1b]133;B\x07ls\n\x1b]133;C\x07a b\n\x1b]133;D;0\x07",
+		`motd
+<div class="ansi-command" data-exit="0"><span class="ansi-prompt">$ </span><span class="ansi-command-input">ls
+</span><span class="ansi-command-output">a b
+</span></div>`)
+	expect("\x1b]133;A\x07\x1b[32m$ \x1b]133;B\x07false\n\x1b]133;C\x1b\\\x1b]133;D;1\x07\x1b]133;A\x07$ \x1b]133;B\x07",
+		`<div class="ansi-command ansi-command-failed" data-exit="1"><span class="ansi-prompt"><span style="color:#8cc265">$ </span></span><span class="ansi-command-input"><span style="color:#8cc265">false
+</span></span><span class="ansi-command-output"></span></div>`+
+			`<div class="ansi-command"><span class="ansi-prompt"><span style="color:#8cc265">$ </span></span><span class="ansi-command-input"></span></div>`)
+	expect("a\x1b]133;D;1\x07\x1b]133;C\x07b", "ab")
+	expect("\x1b]8;;http://example.com\x07a\x1b]133;A\x07$ \x1b]133;D;0\x07\x1b]133;A\x07\x1b]8;;\x07",
+		`<a href="http://example.com" class="ansi-link">a</a>`+
+			`<div class="ansi-command" data-exit="0"><span class="ansi-prompt"><a href="http://example.com" class="ansi-link">$ </a></span></div>`+
+			`<div class="ansi-command"><span class="ansi-prompt"></span></div>`)
+
+	c.ApplyOptions(ansihtml.SetEmulation(ansihtml.LineBuffer))
+	expect("motd\n\x1b]133;A\x07$ \x1b]133;B\x07ls\n\x1b]133;C\x07a b\n\x1b]133;D;0\x07",
+		`motd
+<div class="ansi-command" data-exit="0"><span class="ansi-prompt">$ </span><span class="ansi-command-input">ls
+</span><span class="ansi-command-output">a b
+</span></div>`)
+	expect("10%\x1b]133;A\x07\r$ \x1b]133;B\x07\x1b[2K\rls\n\x1b[31m\x1b]133;C\x07x\rX\x1b]133;D;2\x07",
+		`10%<div class="ansi-command ansi-command-failed" data-exit="2"><span class="ansi-prompt">$ </span><span class="ansi-command-input">ls`+"\n"+`</span>`+
+			`<span class="ansi-command-output"><span style="color:#e05561">X</span></span></div>`)
+
+	c.ApplyOptions(ansihtml.SetEmulation(ansihtml.Screen))
+	newExpectError(t, c)("\x1b]133;A\x07$ ", ansihtml.ErrNotSupported)
+
+	c.ApplyOptions(ansihtml.SetCommandBlocks(false))
+	expect("\x1b]133;A\x07$ \x1b]133;D;0\x07", "$ ")
+}
+
+func TestCommandBlocksClear(t *testing.T) {
+	input := "\x1b]133;A\x07$ \x1b]133;C\x07out\x1b[2J\x1b[Hmore\x1b]133;D;0\x07"
+	split := `<div class="ansi-command"><span class="ansi-prompt">$ </span><span class="ansi-command-output">out</span></div>`
+	rest := `<div class="ansi-command" data-exit="0"><span class="ansi-command-output">more</span></div>`
+	for _, test := range []struct {
+		policy    ansihtml.ClearPolicy
+		emulation ansihtml.Emulation
+		expected  string
+	}{
+		{ansihtml.ClearIgnore, ansihtml.Stream, `<div class="ansi-command" data-exit="0"><span class="ansi-prompt">$ </span><span class="ansi-command-output">outmore</span></div>`},
+		{ansihtml.ClearIgnore, ansihtml.LineBuffer, `<div class="ansi-command" data-exit="0"><span class="ansi-prompt">$ </span><span class="ansi-command-output">more</span></div>`},
+		{ansihtml.ClearSeparator, ansihtml.Stream, split + `<hr class="ansi-screen-separator">` + rest},
+		{ansihtml.ClearSeparator, ansihtml.LineBuffer, split + `<hr class="ansi-screen-separator">` + rest},
+		{ansihtml.ClearSections, ansihtml.Stream, `<section class="ansi-screen" data-index="0">` + split + `</section><section class="ansi-screen" data-index="1">` + rest + `</section>`},
+		{ansihtml.ClearSections, ansihtml.LineBuffer, `<section class="ansi-screen" data-index="0">` + split + `</section><section class="ansi-screen" data-index="1">` + rest + `</section>`},
+		{ansihtml.ClearKeepLast, ansihtml.Stream, rest},
+		{ansihtml.ClearKeepLast, ansihtml.LineBuffer, rest},
+	} {
+		newExpect(t, ansihtml.NewConverter(
+			ansihtml.SetCommandBlocks(true),
+			ansihtml.SetClearPolicy(test.policy),
+			ansihtml.SetEmulation(test.emulation),
+		))(input, test.expected)
+	}
+}
@@ -0,0 +1,809 @@
+package ansihtml
+
+import "bufio"
+
+// maxColumns is the right margin for cursor movements and inserts when the
+// width is unbounded. Only printed characters take a line past it.
+const (
+	tabWidth       = 8
+	defaultColumns = 80
+	defaultRows    = 24
+	maxColumns     = 1024
+)
+
+// wideTail marks the cell covered by the right half of a wide character.
+// lineFill ends a line erased with a background color when the width is
+// unbounded, and is rendered as a fill up to the container edge. written
+// marks the cells already written to the output by flushLine.
+const (
+	wideTail rune = -1
+	lineFill rune = -2
+	written  rune = -3
+)
+
+type cell struct {
+	char      rune
+	combining []rune
+	style     *spanStyle
+	anchor    *anchor
+	html      string
+}
+
+// screen is a grid of cells. A width of zero means lines grow with the text
+// printed, see maxColumns. Lines scrolled off the top of the main screen are
+// written to the output, lines scrolled off the alternate screen or a scroll
+// region are lost.
+type screen struct {
+	lines     [][]cell
+	width     int
+	height    int
+	row       int
+	col       int
+	saved     cursor
+	top       int
+	bottom    int
+	alternate bool
+	tabs      *tabStops
+}
+
+type cursor struct {
+	row int
+	col int
+}
+
+func newScreen(width int, height int, tabs *tabStops) *screen {
+	return &screen{
+		lines:  make([][]cell, height),
+		width:  width,
+		height: height,
+		bottom: height - 1,
+		tabs:   tabs,
+	}
+}
+
+// tabStops holds the stops set by HTS and cleared by TBC on top of the
+// default stop every eight columns.
+type tabStops struct {
+	stops   map[int]bool
+	cleared bool
+}
+
+func (t *tabStops) isStop(col int) bool {
+	if v, ok := t.stops[col]; ok {
+		return v
+	}
+	return !t.cleared && col%tabWidth == 0
+}
+
+func (t *tabStops) set(col int, b bool) {
+	if t.stops == nil {
+		t.stops = map[int]bool{}
+	}
+	t.stops[col] = b
+}
+
+func (t *tabStops) clearAll() {
+	t.stops = nil
+	t.cleared = true
+}
+
+// put writes a character of the given width at the cursor. Wide characters
+// partly overwritten are blanked.
+func (s *screen) put(char rune, width int, style *spanStyle, a *anchor) {
+	line := s.lines[s.row]
+	for len(line) < s.col+width {
+		line = append(line, cell{})
+	}
+	for i := s.col; i < s.col+width; i++ {
+		if line[i].char == wideTail && i > 0 {
+			line[i-1] = cell{char: ' ', style: line[i-1].style, anchor: line[i-1].anchor}
+		}
+		if i+1 < len(line) && line[i+1].char == wideTail {
+			line[i+1] = cell{char: ' ', style: line[i+1].style, anchor: line[i+1].anchor}
+		}
+	}
+	line[s.col] = cell{char: char, style: style, anchor: a, html: line[s.col].html}
+	if width == 2 {
+		line[s.col+1] = cell{char: wideTail, style: style, anchor: a}
+	}
+	s.lines[s.row] = line
+	s.col += width
+}
+
+// markup keeps HTML written by a handler at the cursor, in front of the
+// character of the cell.
+func (s *screen) markup(html string) {
+	line := s.lines[s.row]
+	for len(line) <= s.col {
+		line = append(line, cell{})
+	}
+	line[s.col].html += html
+	s.lines[s.row] = line
+}
+
+// combine attaches a zero-width character to the one before the cursor.
+func (s *screen) combine(char rune) {
+	line := s.lines[s.row]
+	i := s.col - 1
+	if i >= len(line) {
+		return
+	}
+	if i > 0 && line[i].char == wideTail {
+		i--
+	}
+	if i < 0 || line[i].char == 0 {
+		return
+	}
+	line[i].combining = append(line[i].combining, char)
+}
+
+func (s *screen) backspace() {
+	if s.width > 0 && s.col >= s.width {
+		s.col = s.width - 1
+	}
+	if s.col > 0 {
+		s.col--
+	}
+}
+
+func (s *screen) tab(n int) {
+	for ; n > 0; n-- {
+		last := s.width - 1
+		if s.width == 0 {
+			// past every stop set or cleared there is a default one
+			last = s.col
+			for col := range s.tabs.stops {
+				if col > last {
+					last = col
+				}
+			}
+			last += tabWidth
+		}
+		col := s.col + 1
+		for col < last && !s.tabs.isStop(col) {
+			col++
+		}
+		if col > last || (s.width == 0 && !s.tabs.isStop(col)) {
+			return
+		}
+		s.col = col
+	}
+}
+
+func (s *screen) backTab(n int) {
+	for ; n > 0 && s.col > 0; n-- {
+		col := s.col - 1
+		for col > 0 && !s.tabs.isStop(col) {
+			col--
+		}
+		s.col = col
+	}
+}
+
+// limit returns the right margin of a line of length n.
+func (s *screen) limit(n int) int {
+	if s.width > 0 {
+		return s.width
+	}
+	if n < maxColumns {
+		return maxColumns
+	}
+	return n
+}
+
+func (s *screen) moveTo(row int, col int) {
+	s.row = clamp(row, 0, s.height-1)
+	n := len(s.lines[s.row])
+	if n <= s.col {
+		n = s.col + 1
+	}
+	s.col = clamp(col, 0, s.limit(n)-1)
+}
+
+func clamp(v int, min int, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// eraseLine sets the cells in [from, to) of a line to blank. A negative to
+// erases up to the end of the line. A blank with a background color is
+// painted up to the screen width.
+func (s *screen) eraseLine(row int, from int, to int, blank cell) {
+	line := s.lines[row]
+	if from < 0 {
+		from = 0
+	}
+	for from < len(line) && line[from].char == written {
+		from++
+	}
+	if to < 0 {
+		if blank.style == nil || s.width == 0 {
+			if from < len(line) {
+				line = line[:from]
+			}
+			if blank.style != nil {
+				for len(line) < from {
+					line = append(line, cell{})
+				}
+				line = append(line, cell{char: lineFill, style: blank.style})
+			}
+			s.lines[row] = line
+			return
+		}
+		to = s.width
+	}
+	if blank.style == nil && to > len(line) {
+		to = len(line)
+	}
+	if limit := s.limit(len(line)); to > limit {
+		to = limit
+	}
+	for len(line) < to {
+		line = append(line, cell{})
+	}
+	for i := from; i < to; i++ {
+		line[i] = blank
+	}
+	s.lines[row] = line
+}
+
+func (s *screen) eraseDisplay(mode int, blank cell) {
+	switch mode {
+	case 0:
+		s.eraseLine(s.row, s.col, -1, blank)
+		for i := s.row + 1; i < s.height; i++ {
+			s.eraseLine(i, 0, -1, blank)
+		}
+	case 1:
+		for i := 0; i < s.row; i++ {
+			s.eraseLine(i, 0, -1, blank)
+		}
+		s.eraseLine(s.row, 0, s.col+1, blank)
+	case 2:
+		for i := range s.lines {
+			s.eraseLine(i, 0, -1, blank)
+		}
+	}
+}
+
+func (s *screen) insertChars(n int) {
+	line := s.lines[s.row]
+	if s.col >= len(line) {
+		return
+	}
+	limit := s.limit(len(line))
+	n = clamp(n, 0, limit-s.col)
+	size := len(line) + n
+	if size > limit {
+		size = limit
+	}
+	for len(line) < size {
+		line = append(line, cell{})
+	}
+	copy(line[s.col+n:], line[s.col:])
+	for i := s.col; i < s.col+n; i++ {
+		line[i] = cell{}
+	}
+	s.lines[s.row] = line
+}
+
+func (s *screen) deleteChars(n int) {
+	line := s.lines[s.row]
+	if s.col >= len(line) {
+		return
+	}
+	if n > len(line)-s.col {
+		n = len(line) - s.col
+	}
+	s.lines[s.row] = append(line[:s.col], line[s.col+n:]...)
+}
+
+func (s *screen) insertLines(n int) {
+	if s.row < s.top || s.row > s.bottom {
+		return
+	}
+	s.scrollDown(s.row, n)
+	s.col = 0
+}
+
+func (s *screen) deleteLines(n int) {
+	if s.row < s.top || s.row > s.bottom {
+		return
+	}
+	s.scrollUp(s.row, n)
+	s.col = 0
+}
+
+// scrollUp moves the lines from top to the bottom margin up by n.
+func (s *screen) scrollUp(top int, n int) {
+	region := s.lines[top : s.bottom+1]
+	n = clamp(n, 0, len(region))
+	copy(region, region[n:])
+	for i := len(region) - n; i < len(region); i++ {
+		region[i] = nil
+	}
+}
+
+// scrollDown moves the lines from top to the bottom margin down by n.
+func (s *screen) scrollDown(top int, n int) {
+	region := s.lines[top : s.bottom+1]
+	n = clamp(n, 0, len(region))
+	copy(region[n:], region)
+	for i := 0; i < n; i++ {
+		region[i] = nil
+	}
+}
+
+func (s *screen) setMargins(top int, bottom int) {
+	if bottom <= 0 || bottom > s.height {
+		bottom = s.height
+	}
+	if top < 1 {
+		top = 1
+	}
+	if top >= bottom {
+		return
+	}
+	s.top, s.bottom = top-1, bottom-1
+	s.moveTo(0, 0)
+}
+
+func (c *Converter) lineFeed(w writer) error {
+	c.screen.col = 0
+	return c.index(w)
+}
+
+func (c *Converter) index(w writer) error {
+	s := c.screen
+	if s.row == s.bottom {
+		return c.scroll(w, 1)
+	}
+	if s.row < s.height-1 {
+		s.row++
+	}
+	return nil
+}
+
+func (c *Converter) reverseIndex() {
+	s := c.screen
+	if s.row == s.top {
+		s.scrollDown(s.top, 1)
+	} else if s.row > 0 {
+		s.row--
+	}
+}
+
+// scroll moves the scroll region up by n lines. The lines leaving the top of
+// the main screen go to the output.
+func (c *Converter) scroll(w writer, n int) error {
+	s := c.screen
+	if s.top == 0 && !s.alternate && c.keepMainScreen() {
+		for i := 0; i < n && i <= s.bottom; i++ {
+			if err := c.renderLine(w, s.lines[i]); err != nil {
+				return err
+			}
+			if _, err := w.WriteRune('\n'); err != nil {
+				return err
+			}
+		}
+	}
+	s.scrollUp(s.top, n)
+	return nil
+}
+
+func (c *Converter) screenReset() error {
+	if c.screen.alternate {
+		if err := c.setAltScreen(1047, false); err != nil {
+			return err
+		}
+	}
+	s := c.screen
+	s.eraseDisplay(2, cell{})
+	s.moveTo(0, 0)
+	*s.tabs = tabStops{}
+	c.cellAnchor = nil
+	return nil
+}
+
+func (c *Converter) keepMainScreen() bool {
+	return c.emulation != Screen || c.altScreenPolicy != AltScreenOnly
+}
+
+func (c *Converter) setAltScreen(mode int, enable bool) error {
+	if c.emulation != Screen || enable == c.screen.alternate {
+		return nil
+	}
+	if enable {
+		if mode == 1049 {
+			c.mainScreen.saved = cursor{c.mainScreen.row, c.mainScreen.col}
+		}
+		if c.altScreen == nil || mode == 1049 {
+			c.altScreen = newScreen(c.mainScreen.width, c.mainScreen.height, c.mainScreen.tabs)
+			c.altScreen.alternate = true
+		}
+		c.screen = c.altScreen
+		return nil
+	}
+	if err := c.closeAltScreen(); err != nil {
+		return err
+	}
+	if mode != 47 {
+		c.altScreen = nil
+	}
+	c.screen = c.mainScreen
+	if mode == 1049 {
+		c.screen.moveTo(c.screen.saved.row, c.screen.saved.col)
+	}
+	return nil
+}
+
+// closeAltScreen keeps the alternate screen as a block written after the
+// main screen.
+func (c *Converter) closeAltScreen() error {
+	if c.altScreenPolicy == AltScreenMainOnly {
+		return nil
+	}
+	w := bufio.NewWriter(&c.altBlocks)
+	if _, err := w.WriteString(`<div class="` + c.classPrefix + `alt-screen">`); err != nil {
+		return err
+	}
+	s := c.screen
+	end := -1
+	for i := len(s.lines) - 1; i >= 0; i-- {
+		if len(trimLine(s.lines[i])) > 0 {
+			end = i
+			break
+		}
+	}
+	for i := 0; i <= end; i++ {
+		if err := c.renderLine(w, s.lines[i]); err != nil {
+			return err
+		}
+		if i < end {
+			if _, err := w.WriteRune('\n'); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := w.WriteString("</div>"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func (c *Converter) screenRune(w writer, char rune) error {
+	s := c.screen
+	width := runeWidth(char)
+	if width == 0 {
+		s.combine(char)
+		return nil
+	}
+	if c.cellStyle == nil || c.cellAttributes != c.attributes {
+		style, err := c.gatherStyle()
+		if err != nil {
+			return err
+		}
+		c.cellStyle = style
+		c.cellAttributes = c.attributes
+	}
+	if s.width > 0 && s.col+width > s.width {
+		// a character wider than the screen never fits, wrapping would only
+		// leave an empty line
+		if c.autoWrap && (s.col > 0 || width <= s.width) {
+			if err := c.lineFeed(w); err != nil {
+				return err
+			}
+		} else {
+			s.col = s.width - width
+		}
+		if s.col < 0 || width > s.width {
+			s.col = 0
+			width = 1
+			char = ' '
+		}
+	}
+	s.put(char, width, c.cellStyle, c.cellAnchor)
+	return nil
+}
+
+// blankCell is the cell left by an erase, which keeps the current background
+// color (BCE).
+func (c *Converter) blankCell() (cell, error) {
+	style, err := c.backgroundStyle()
+	return cell{style: style}, err
+}
+
+func (c *Converter) screenExecute(w writer, char rune) error {
+	switch char {
+	case xLF, xVT, xFF:
+		return c.lineFeed(w)
+	case xCR:
+		c.screen.col = 0
+	case xBS:
+		c.screen.backspace()
+	case xHT:
+		c.screen.tab(1)
+	case xHTS:
+		c.screen.tabs.set(c.screen.col, true)
+	case xIND:
+		return c.index(w)
+	case xNEL:
+		return c.lineFeed(w)
+	case xRI:
+		c.reverseIndex()
+	}
+	return nil
+}
+
+func (c *Converter) screenESC(w writer, seq *sequence) error {
+	s := c.screen
+	switch seq.final {
+	case x7:
+		s.saved = cursor{s.row, s.col}
+	case x8:
+		s.moveTo(s.saved.row, s.saved.col)
+	case xD:
+		return c.index(w)
+	case xE:
+		return c.lineFeed(w)
+	case xM:
+		c.reverseIndex()
+	case xH:
+		s.tabs.set(s.col, true)
+	}
+	return nil
+}
+
+func (c *Converter) screenCSI(w writer, seq *sequence) error {
+	s := c.screen
+	if seq.private == xQuestion {
+		switch seq.final {
+		case xh, xl:
+			for i := range seq.params {
+				switch mode := seq.param(i, 0); mode {
+				case 7:
+					c.autoWrap = seq.final == xh
+				case 47, 1047, 1049:
+					if err := c.setAltScreen(mode, seq.final == xh); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	if seq.private != 0 || len(seq.intermediates) > 0 {
+		return nil
+	}
+	switch seq.final {
+	case xr:
+		s.setMargins(seq.param(0, 1), seq.param(1, s.height))
+	case xS:
+		return c.scroll(w, seq.param(0, 1))
+	case xT:
+		if len(seq.params) == 1 {
+			s.scrollDown(s.top, seq.param(0, 1))
+		}
+	case xA:
+		s.moveTo(s.row-seq.param(0, 1), s.col)
+	case xB:
+		s.moveTo(s.row+seq.param(0, 1), s.col)
+	case xC:
+		s.moveTo(s.row, s.col+seq.param(0, 1))
+	case xD:
+		s.moveTo(s.row, s.col-seq.param(0, 1))
+	case xE:
+		s.moveTo(s.row+seq.param(0, 1), 0)
+	case xF:
+		s.moveTo(s.row-seq.param(0, 1), 0)
+	case xG, xBackstick:
+		s.moveTo(s.row, seq.param(0, 1)-1)
+	case xH, xf:
+		s.moveTo(seq.param(0, 1)-1, seq.param(1, 1)-1)
+	case xd:
+		s.moveTo(seq.param(0, 1)-1, s.col)
+	case xJ:
+		blank, err := c.blankCell()
+		if err != nil {
+			return err
+		}
+		s.eraseDisplay(seq.param(0, 0), blank)
+	case xX:
+		blank, err := c.blankCell()
+		if err != nil {
+			return err
+		}
+		s.eraseLine(s.row, s.col, s.col+seq.param(0, 1), blank)
+	case xAt:
+		s.insertChars(seq.param(0, 1))
+	case xP:
+		s.deleteChars(seq.param(0, 1))
+	case xL:
+		s.insertLines(seq.param(0, 1))
+	case xM:
+		s.deleteLines(seq.param(0, 1))
+	case xI:
+		s.tab(seq.param(0, 1))
+	case xZ:
+		s.backTab(seq.param(0, 1))
+	case xg:
+		switch seq.param(0, 0) {
+		case 0:
+			s.tabs.set(s.col, false)
+		case 3:
+			s.tabs.clearAll()
+		}
+	case xs:
+		s.saved = cursor{s.row, s.col}
+	case xu:
+		s.moveTo(s.saved.row, s.saved.col)
+	case xK:
+		blank, err := c.blankCell()
+		if err != nil {
+			return err
+		}
+		switch seq.param(0, 0) {
+		case 0:
+			s.eraseLine(s.row, s.col, -1, blank)
+		case 1:
+			s.eraseLine(s.row, 0, s.col+1, blank)
+		case 2:
+			s.eraseLine(s.row, 0, -1, blank)
+		}
+	}
+	return nil
+}
+
+// flushScreen writes the lines left on the main screen, followed by the
+// alternate screen blocks. Lines above the cursor keep their line break.
+func (c *Converter) flushScreen(w writer) error {
+	if c.screen.alternate {
+		if err := c.closeAltScreen(); err != nil {
+			return err
+		}
+	}
+	if c.keepMainScreen() {
+		if err := c.renderScreen(w, c.mainScreen); err != nil {
+			return err
+		}
+	}
+	_, err := c.altBlocks.WriteTo(w)
+	return err
+}
+
+func (c *Converter) renderScreen(w writer, s *screen) error {
+	end := s.row - 1
+	for i := len(s.lines) - 1; i > end; i-- {
+		if len(trimLine(s.lines[i])) > 0 {
+			end = i
+			break
+		}
+	}
+	for i := 0; i <= end; i++ {
+		if err := c.renderLine(w, s.lines[i]); err != nil {
+			return err
+		}
+		if i < end || i < s.row {
+			if _, err := w.WriteRune('\n'); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flushLine writes the cursor line as it is so far, ahead of markup that has
+// to follow it. Its cells are kept as written, and erasing them leaves them
+// so.
+func (c *Converter) flushLine(w writer) error {
+	line := trimLine(c.screen.lines[c.screen.row])
+	if err := c.renderLine(w, line); err != nil {
+		return err
+	}
+	for i := range line {
+		line[i] = cell{char: written}
+	}
+	return nil
+}
+
+func trimLine(line []cell) []cell {
+	end := len(line)
+	for end > 0 && line[end-1].char == 0 && line[end-1].style == nil && line[end-1].html == "" {
+		end--
+	}
+	return line[:end]
+}
+
+func (c *Converter) renderLine(w writer, line []cell) error {
+	var style *spanStyle
+	var a *anchor
+	isSpan := false
+	line = trimLine(line)
+	for i, cl := range line {
+		if cl.char == written || (cl.char == wideTail && i > 0 && runeWidth(line[i-1].char) == 2) {
+			continue
+		}
+		if cl.char == lineFill && i == len(line)-1 {
+			if isSpan {
+				if _, err := c.spanClose(w); err != nil {
+					return err
+				}
+				isSpan = false
+			}
+			if _, err := c.fill(w, cl.style); err != nil {
+				return err
+			}
+			break
+		}
+		if cl.anchor != a {
+			if isSpan {
+				if _, err := c.spanClose(w); err != nil {
+					return err
+				}
+				isSpan = false
+				style = nil
+			}
+			if a != nil {
+				if _, err := c.anchorClose(w); err != nil {
+					return err
+				}
+			}
+			if cl.anchor != nil {
+				if _, err := c.anchorOpen(w, cl.anchor); err != nil {
+					return err
+				}
+			}
+			a = cl.anchor
+		}
+		if !c.equalStyle(style, cl.style) || (!isSpan && c.needStyle(cl.style)) {
+			if isSpan {
+				if _, err := c.spanClose(w); err != nil {
+					return err
+				}
+			}
+			isSpan = c.needStyle(cl.style)
+			if isSpan {
+				if _, err := c.spanOpen(w, cl.style); err != nil {
+					return err
+				}
+			}
+		}
+		style = cl.style
+		if cl.html != "" {
+			if _, err := w.WriteString(cl.html); err != nil {
+				return err
+			}
+			if cl.char == 0 && i == len(line)-1 {
+				break
+			}
+		}
+		char := cl.char
+		if char == 0 || char == wideTail || char == lineFill {
+			char = ' '
+		}
+		if _, err := c.rune(w, char); err != nil {
+			return err
+		}
+		for _, r := range cl.combining {
+			if _, err := c.rune(w, r); err != nil {
+				return err
+			}
+		}
+	}
+	if isSpan {
+		if _, err := c.spanClose(w); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if _, err := c.anchorClose(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package ansihtml
+
+type SequenceKind int
+
+const (
+	ESC SequenceKind = iota
+	CSI
+	OSC
+	DCS
+	SOS
+	PM
+	APC
+)
+
+// Sequence is a control sequence or control string as seen by the parser.
+// Params holds one group per parameter, with the sub-parameters separated by
+// colons. Data is the payload of OSC, DCS, SOS, PM and APC strings.
+type Sequence struct {
+	Kind          SequenceKind
+	Private       rune
+	Intermediates string
+	Params        [][]int
+	Final         rune
+	Data          string
+}
+
+// Param returns the i-th parameter, or def if it is missing or zero.
+func (s *Sequence) Param(i int, def int) int {
+	if i >= len(s.Params) || s.Params[i][0] == 0 {
+		return def
+	}
+	return s.Params[i][0]
+}
+
+// StringHandler receives the DCS, SOS, PM and APC strings, which are
+// otherwise dropped.
+type StringHandler func(seq *Sequence) error
+
+func newSequence(kind SequenceKind, seq *sequence) *Sequence {
+	s := &Sequence{
+		Kind:          kind,
+		Private:       seq.private,
+		Intermediates: string(seq.intermediates),
+		Final:         seq.final,
+	}
+	for _, group := range seq.params {
+		param := make([]int, len(group))
+		for i, v := range group {
+			param[i] = int(v)
+		}
+		s.Params = append(s.Params, param)
+	}
+	return s
+}
+
+func (c *Converter) dcsHook(w writer, seq *sequence) error {
+	if err := c.flushOverstrike(w); err != nil {
+		return err
+	}
+	c.dcs = newSequence(DCS, seq)
+	c.dcsData.Reset()
+	return nil
+}
+
+func (c *Converter) dcsPut(w writer, char rune) error {
+	if c.dcsData.Len() < maxStringLength {
+		_, _ = c.dcsData.WriteRune(char)
+	}
+	return nil
+}
+
+func (c *Converter) dcsUnhook(w writer) error {
+	seq := c.dcs
+	c.dcs = nil
+	if seq == nil {
+		return nil
+	}
+	seq.Data = c.dcsData.String()
+	c.dcsData.Reset()
+	if ok, err := c.hook(w, int(seq.Final), seq); ok || err != nil {
+		return err
+	}
+	if c.stringHandler == nil {
+		return nil
+	}
+	return c.stringHandler(seq)
+}
+
+func (c *Converter) stringDispatch(w writer, introducer rune, data string) error {
+	if err := c.flushOverstrike(w); err != nil {
+		return err
+	}
+	kind := APC
+	switch introducer {
+	case xSOS:
+		kind = SOS
+	case xPM:
+		kind = PM
+	}
+	seq := &Sequence{Kind: kind, Data: data}
+	if ok, err := c.hook(w, 0, seq); ok || err != nil {
+		return err
+	}
+	if c.stringHandler == nil {
+		return nil
+	}
+	return c.stringHandler(seq)
+}
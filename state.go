@@ -0,0 +1,372 @@
+package ansihtml
+
+import "strings"
+
+// The parser follows the DEC VT500 state machine described by Paul Williams
+// (https://vt100.net/emu/dec_ansi_parser).
+
+type parserState int
+
+const (
+	psGround parserState = iota
+	psEscape
+	psEscapeIntermediate
+	psCsiEntry
+	psCsiParam
+	psCsiIntermediate
+	psCsiIgnore
+	psDcsEntry
+	psDcsParam
+	psDcsIntermediate
+	psDcsPassthrough
+	psDcsIgnore
+	psOscString
+	psSosPmApcString
+)
+
+const (
+	maxParams        = 32
+	maxSubParams     = 16
+	maxIntermediates = 2
+	maxParamValue    = 0xffff
+	maxStringLength  = 1 << 16
+)
+
+type sequence struct {
+	private       rune
+	intermediates []rune
+	params        [][]rune
+	final         rune
+}
+
+// param returns the i-th parameter, or def if it is missing or zero.
+func (s *sequence) param(i int, def int) int {
+	if i >= len(s.params) || s.params[i][0] == 0 {
+		return def
+	}
+	return int(s.params[i][0])
+}
+
+type handler interface {
+	print(w writer, char rune) error
+	execute(w writer, char rune) error
+	escDispatch(w writer, seq *sequence) error
+	csiDispatch(w writer, seq *sequence) error
+	oscDispatch(w writer, data string) error
+	dcsHook(w writer, seq *sequence) error
+	dcsPut(w writer, char rune) error
+	dcsUnhook(w writer) error
+	stringDispatch(w writer, introducer rune, data string) error
+}
+
+type vtParser struct {
+	state       parserState
+	seq         sequence
+	group       []rune
+	param       rune
+	overflow    bool
+	osc         strings.Builder
+	introducer  rune
+	tmux        tmuxState
+	tmuxMatched int
+	tmuxEscape  bool
+	inner       *vtParser
+}
+
+func (p *vtParser) reset() {
+	p.state = psGround
+	p.tmux = tmuxNone
+	p.inner = nil
+	p.clear()
+}
+
+func (p *vtParser) clear() {
+	p.seq = sequence{}
+	p.group = nil
+	p.param = 0
+	p.overflow = false
+}
+
+func (p *vtParser) collect(char rune) {
+	if len(p.seq.intermediates) >= maxIntermediates {
+		p.overflow = true
+		return
+	}
+	p.seq.intermediates = append(p.seq.intermediates, char)
+}
+
+func (p *vtParser) putParam(char rune) {
+	switch char {
+	case xColon:
+		if len(p.group) >= maxSubParams-1 {
+			p.overflow = true
+			return
+		}
+		p.group = append(p.group, p.param)
+		p.param = 0
+	case xSemiColon:
+		if len(p.seq.params) >= maxParams-1 {
+			p.overflow = true
+			return
+		}
+		p.seq.params = append(p.seq.params, append(p.group, p.param))
+		p.group = nil
+		p.param = 0
+	default:
+		p.param = 10*p.param + (char - '0')
+		if p.param > maxParamValue {
+			p.param = maxParamValue
+		}
+	}
+}
+
+func (p *vtParser) finish(final rune) *sequence {
+	p.seq.params = append(p.seq.params, append(p.group, p.param))
+	p.group = nil
+	p.param = 0
+	p.seq.final = final
+	return &p.seq
+}
+
+func (p *vtParser) transition(h handler, w writer, state parserState) error {
+	switch p.state {
+	case psOscString:
+		data := p.osc.String()
+		p.osc.Reset()
+		if err := h.oscDispatch(w, data); err != nil {
+			return err
+		}
+	case psDcsPassthrough:
+		if p.tmux == tmuxMatching {
+			if err := p.tmuxMismatch(h, w); err != nil {
+				return err
+			}
+		}
+		if p.tmux == tmuxActive {
+			p.inner = nil
+		} else if err := h.dcsUnhook(w); err != nil {
+			return err
+		}
+		p.tmux = tmuxNone
+	case psSosPmApcString:
+		data := p.osc.String()
+		p.osc.Reset()
+		if err := h.stringDispatch(w, p.introducer, data); err != nil {
+			return err
+		}
+	}
+	p.state = state
+	switch state {
+	case psEscape, psCsiEntry, psDcsEntry:
+		p.clear()
+	case psOscString, psSosPmApcString:
+		p.osc.Reset()
+	}
+	return nil
+}
+
+// The SOS, PM and APC introducers in their 7-bit form.
+var stringIntroducers = map[rune]rune{
+	xX:          xSOS,
+	xCaret:      xPM,
+	xUnderscore: xAPC,
+}
+
+func isExecute(char rune) bool {
+	return char < 0x18 || char == 0x19 || (char >= 0x1c && char < 0x20)
+}
+
+func (p *vtParser) advance(h handler, w writer, char rune) error {
+	if p.state == psDcsPassthrough && p.tmux != tmuxNone {
+		return p.tmuxAdvance(h, w, char)
+	}
+	// transitions from anywhere
+	switch {
+	case char == xCAN || char == xSUB:
+		if err := p.transition(h, w, psGround); err != nil {
+			return err
+		}
+		return h.execute(w, char)
+	case char == xESC:
+		return p.transition(h, w, psEscape)
+	case char == xST:
+		return p.transition(h, w, psGround)
+	case char == xDCS:
+		return p.transition(h, w, psDcsEntry)
+	case char == xSOS || char == xPM || char == xAPC:
+		if err := p.transition(h, w, psSosPmApcString); err != nil {
+			return err
+		}
+		p.introducer = char
+		return nil
+	case char == xCSI:
+		return p.transition(h, w, psCsiEntry)
+	case char == xOSC:
+		return p.transition(h, w, psOscString)
+	case char >= 0x80 && char < 0xa0:
+		if err := p.transition(h, w, psGround); err != nil {
+			return err
+		}
+		return h.execute(w, char)
+	}
+
+	switch p.state {
+	case psGround:
+		if isExecute(char) {
+			return h.execute(w, char)
+		}
+		if char == xDEL {
+			return nil
+		}
+		return h.print(w, char)
+	case psEscape:
+		switch {
+		case isExecute(char):
+			return h.execute(w, char)
+		case char >= 0x20 && char < 0x30:
+			p.collect(char)
+			p.state = psEscapeIntermediate
+		case char == xLeftSquareBracket:
+			return p.transition(h, w, psCsiEntry)
+		case char == xRightSquareBracket:
+			return p.transition(h, w, psOscString)
+		case char == xP:
+			return p.transition(h, w, psDcsEntry)
+		case char == xX || char == xCaret || char == xUnderscore:
+			if err := p.transition(h, w, psSosPmApcString); err != nil {
+				return err
+			}
+			p.introducer = stringIntroducers[char]
+		case char >= 0x30 && char < 0x7f:
+			return p.escDispatch(h, w, char)
+		}
+	case psEscapeIntermediate:
+		switch {
+		case isExecute(char):
+			return h.execute(w, char)
+		case char >= 0x20 && char < 0x30:
+			p.collect(char)
+		case char >= 0x30 && char < 0x7f:
+			return p.escDispatch(h, w, char)
+		}
+	case psCsiEntry, psCsiParam:
+		switch {
+		case isExecute(char):
+			return h.execute(w, char)
+		case char >= 0x20 && char < 0x30:
+			p.collect(char)
+			p.state = psCsiIntermediate
+		case (char >= '0' && char <= '9') || char == xSemiColon || char == xColon:
+			p.putParam(char)
+			p.state = psCsiParam
+		case char >= xLessThan && char <= xQuestion && p.state == psCsiEntry:
+			p.seq.private = char
+			p.state = psCsiParam
+		case char >= 0x30 && char < 0x40:
+			p.state = psCsiIgnore
+		case char >= 0x40 && char < 0x7f:
+			return p.csiDispatch(h, w, char)
+		}
+	case psCsiIntermediate:
+		switch {
+		case isExecute(char):
+			return h.execute(w, char)
+		case char >= 0x20 && char < 0x30:
+			p.collect(char)
+		case char >= 0x30 && char < 0x40:
+			p.state = psCsiIgnore
+		case char >= 0x40 && char < 0x7f:
+			return p.csiDispatch(h, w, char)
+		}
+	case psCsiIgnore:
+		switch {
+		case isExecute(char):
+			return h.execute(w, char)
+		case char >= 0x40 && char < 0x7f:
+			p.state = psGround
+		}
+	case psDcsEntry, psDcsParam:
+		switch {
+		case char >= 0x20 && char < 0x30:
+			p.collect(char)
+			p.state = psDcsIntermediate
+		case (char >= '0' && char <= '9') || char == xSemiColon:
+			p.putParam(char)
+			p.state = psDcsParam
+		case char >= xLessThan && char <= xQuestion && p.state == psDcsEntry:
+			p.seq.private = char
+			p.state = psDcsParam
+		case char >= 0x30 && char < 0x40:
+			p.state = psDcsIgnore
+		case char >= 0x40 && char < 0x7f:
+			return p.dcsHook(h, w, char)
+		}
+	case psDcsIntermediate:
+		switch {
+		case char >= 0x20 && char < 0x30:
+			p.collect(char)
+		case char >= 0x30 && char < 0x40:
+			p.state = psDcsIgnore
+		case char >= 0x40 && char < 0x7f:
+			return p.dcsHook(h, w, char)
+		}
+	case psDcsPassthrough:
+		if char == xBEL {
+			return p.transition(h, w, psGround)
+		}
+		if char != xDEL {
+			return h.dcsPut(w, char)
+		}
+	case psOscString:
+		if char == xBEL {
+			return p.transition(h, w, psGround)
+		}
+		if char >= 0x20 && char != xDEL && p.osc.Len() < maxStringLength {
+			_, _ = p.osc.WriteRune(char)
+		}
+	case psSosPmApcString:
+		if char == xBEL {
+			return p.transition(h, w, psGround)
+		}
+		if p.osc.Len() < maxStringLength {
+			_, _ = p.osc.WriteRune(char)
+		}
+	case psDcsIgnore:
+		if char == xBEL {
+			p.state = psGround
+		}
+	}
+	return nil
+}
+
+func (p *vtParser) escDispatch(h handler, w writer, final rune) error {
+	p.state = psGround
+	if p.overflow {
+		return nil
+	}
+	p.seq.final = final
+	return h.escDispatch(w, &p.seq)
+}
+
+func (p *vtParser) csiDispatch(h handler, w writer, final rune) error {
+	p.state = psGround
+	if p.overflow {
+		return nil
+	}
+	return h.csiDispatch(w, p.finish(final))
+}
+
+func (p *vtParser) dcsHook(h handler, w writer, final rune) error {
+	if p.overflow {
+		p.state = psDcsIgnore
+		return nil
+	}
+	p.state = psDcsPassthrough
+	seq := p.finish(final)
+	if p.tmuxCandidate(final) {
+		p.tmux = tmuxMatching
+		p.tmuxMatched = 0
+		return nil
+	}
+	return h.dcsHook(w, seq)
+}
@@ -0,0 +1,72 @@
+package ansihtml
+
+// tmux wraps the sequences meant for the outer terminal in a DCS with the
+// payload "tmux;" and every ESC doubled: ESC P tmux; ESC ESC ] ... ESC \
+
+const tmuxPrefix = "mux;"
+
+type tmuxState int
+
+const (
+	tmuxNone tmuxState = iota
+	tmuxMatching
+	tmuxActive
+)
+
+// tmuxCandidate reports if the DCS may be a tmux passthrough, which is told
+// apart from other DCS strings by the rest of the prefix.
+func (p *vtParser) tmuxCandidate(final rune) bool {
+	return final == xt && p.seq.private == 0 && len(p.seq.intermediates) == 0 &&
+		len(p.seq.params) == 1 && len(p.seq.params[0]) == 1 && p.seq.params[0][0] == 0
+}
+
+func (p *vtParser) tmuxAdvance(h handler, w writer, char rune) error {
+	if p.tmux == tmuxMatching {
+		if char == rune(tmuxPrefix[p.tmuxMatched]) {
+			p.tmuxMatched++
+			if p.tmuxMatched == len(tmuxPrefix) {
+				p.tmux = tmuxActive
+				p.tmuxEscape = false
+				p.inner = &vtParser{}
+			}
+			return nil
+		}
+		if err := p.tmuxMismatch(h, w); err != nil {
+			return err
+		}
+		return p.advance(h, w, char)
+	}
+	if p.tmuxEscape {
+		p.tmuxEscape = false
+		if char == xESC {
+			return p.inner.advance(h, w, xESC)
+		}
+		if err := p.transition(h, w, psEscape); err != nil {
+			return err
+		}
+		return p.advance(h, w, char)
+	}
+	if char == xESC {
+		p.tmuxEscape = true
+		return nil
+	}
+	if char == xST {
+		return p.transition(h, w, psGround)
+	}
+	return p.inner.advance(h, w, char)
+}
+
+// tmuxMismatch hands a DCS that turned out not to be tmux to the handler,
+// with the part of the prefix already consumed.
+func (p *vtParser) tmuxMismatch(h handler, w writer) error {
+	p.tmux = tmuxNone
+	if err := h.dcsHook(w, &p.seq); err != nil {
+		return err
+	}
+	for _, char := range tmuxPrefix[:p.tmuxMatched] {
+		if err := h.dcsPut(w, char); err != nil {
+			return err
+		}
+	}
+	return nil
+}